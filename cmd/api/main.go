@@ -1,11 +1,397 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-pg/pg"
+	goredis "github.com/go-redis/redis"
+
+	"github.com/ribice/chisk/internal/pkg/secure"
+	"github.com/ribice/chisk/internal/user"
+	userdb "github.com/ribice/chisk/internal/user/platform/pgsql"
+	"github.com/ribice/chisk/internal/user/transport"
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/config"
+	"github.com/ribice/chisk/pkg/health"
+	"github.com/ribice/chisk/pkg/jwt"
+	"github.com/ribice/chisk/pkg/metrics"
+	"github.com/ribice/chisk/pkg/middleware/basicauth"
+	"github.com/ribice/chisk/pkg/middleware/clientip"
+	"github.com/ribice/chisk/pkg/middleware/cors"
+	"github.com/ribice/chisk/pkg/middleware/ratelimit"
+	"github.com/ribice/chisk/pkg/middleware/recovery"
+	securemw "github.com/ribice/chisk/pkg/middleware/secure"
+	"github.com/ribice/chisk/pkg/openapi"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/redis"
+	"github.com/ribice/chisk/pkg/requestid"
+	"github.com/ribice/chisk/pkg/session"
+	"github.com/ribice/chisk/pkg/trace"
+	"github.com/ribice/chisk/pkg/zerolog"
 )
 
 func main() {
+	cfgPath := flag.String("p", "./cmd/api/conf.local.yaml", "Path to config file")
+	migrationsDir := flag.String("m", "./internal/migrations", "Path to migrations directory, used by migrate create")
+	flag.Parse()
+
+	if flag.Arg(0) == "migrate" {
+		checkErr(runMigrate(*cfgPath, *migrationsDir, flag.Args()[1:]))
+		return
+	}
+
+	cfg, err := config.Load(*cfgPath)
+	checkErr(err)
+
+	// ctx is cancelled on shutdown, stopping background jobs and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log, err := zerolog.New(logOptions(cfg.Log))
+	checkErr(err)
+	defer log.Close()
+
+	reg := metrics.NewRegistry()
+	reg.GaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	dbMetrics := metrics.NewDB(reg)
+
+	tracer, err := newTracer(cfg.Trace, log)
+	checkErr(err)
+	defer tracer.Close()
+
+	db, err := pgsql.New(cfg.DB.PSN, dbOptions(cfg.DB, log))
+	checkErr(err)
+	db.OnQueryProcessed(dbMetrics.Hook("primary"))
+	db.OnQueryProcessed(tracer.QueryHook("primary"))
+	reg.GaugeFunc("db_pool_total_connections", "Number of open primary database connections.", func() float64 {
+		return float64(pgsql.PoolStats(db).TotalConns)
+	})
+	reg.GaugeFunc("db_pool_idle_connections", "Number of idle primary database connections.", func() float64 {
+		return float64(pgsql.PoolStats(db).IdleConns)
+	})
+	reg.CounterFunc("db_pool_hits_total", "Number of times a free primary database connection was found in the pool.", func() float64 {
+		return float64(pgsql.PoolStats(db).Hits)
+	})
+	reg.CounterFunc("db_pool_misses_total", "Number of times a new primary database connection had to be opened.", func() float64 {
+		return float64(pgsql.PoolStats(db).Misses)
+	})
+	reg.CounterFunc("db_pool_timeouts_total", "Number of times waiting for a free primary database connection timed out.", func() float64 {
+		return float64(pgsql.PoolStats(db).Timeouts)
+	})
+
+	var replicas []*pg.DB
+	for _, psn := range cfg.DB.Replicas {
+		replica, err := pgsql.New(psn, dbOptions(cfg.DB, log))
+		checkErr(err)
+		replica.OnQueryProcessed(dbMetrics.Hook("replica"))
+		replica.OnQueryProcessed(tracer.QueryHook("replica"))
+		replicas = append(replicas, replica)
+	}
+	cluster := pgsql.NewCluster(db, replicas...)
+	if len(replicas) > 0 && cfg.DB.ReplicaCheckSeconds > 0 {
+		go cluster.RunHealthChecks(ctx, time.Duration(cfg.DB.ReplicaCheckSeconds)*time.Second)
+	}
+
+	if cfg.DB.SoftDeleteRetentionDays > 0 && cfg.DB.PurgeIntervalHours > 0 {
+		purger := pgsql.NewPurger(db, time.Duration(cfg.DB.SoftDeleteRetentionDays)*24*time.Hour, log, (*chisk.User)(nil))
+		go purger.Run(ctx, time.Duration(cfg.DB.PurgeIntervalHours)*time.Hour)
+	}
+
+	rc := &redisClient{cfg: cfg.Redis, metrics: metrics.NewRedis(reg)}
+	store, err := sessionStore(cfg, db, rc)
+	checkErr(err)
+	switch st := store.(type) {
+	case *session.RedisStore:
+		st.Instrument(tracer.InstrumentRedis)
+	case *session.PGStore:
+		if cfg.Session.CleanupInterval > 0 {
+			go st.RunCleanup(ctx, time.Duration(cfg.Session.CleanupInterval)*time.Second, log)
+		}
+	case *session.MemoryStore:
+		defer st.Close()
+	}
+
+	if cfg.Session.Secret == "" {
+		checkErr(fmt.Errorf("session secret is not configured"))
+	}
+
+	sess := session.New(store, session.Options{
+		Secret:           cfg.Session.Secret,
+		MigrateLegacy:    cfg.Session.MigrateLegacy,
+		Lifetime:         time.Duration(cfg.Session.Duration) * time.Hour,
+		IdleTimeout:      time.Duration(cfg.Session.IdleTimeout) * time.Minute,
+		AdminIdleTimeout: time.Duration(cfg.Session.AdminIdleTimeout) * time.Minute,
+		TouchInterval:    time.Duration(cfg.Session.TouchInterval) * time.Second,
+		Events:           reg.Counter("session_events_total", "Number of created, deleted and revoked sessions, not of active ones.", "event"),
+	})
+	reg.GaugeFunc("sessions_active", "Number of sessions that have not expired, counted on every scrape.", func() float64 {
+		n, err := sess.Active()
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	})
+	j := jwt.New(cfg.JWT.Secret, cfg.JWT.Duration, cfg.JWT.Algorithm, sess, log)
+	j.CountValidations(reg.Counter("auth_token_validations_total", "Number of bearer token validations on authenticated requests by result.", "result"))
+
+	rlStore, err := rateLimitStore(cfg, rc)
+	checkErr(err)
+	limiter, err := ratelimit.New(rlStore, log, rateLimitRules(cfg.RateLimit)...)
+	checkErr(err)
+
+	v1 := chi.NewRouter()
+	userSvc := user.New(sess, userdb.New(cluster), pgsql.NewTxRunner(db, pgsql.DefaultTxRetries), secure.New(cfg.App.MinPasswordStrength), j)
+	userSvc.CountLogins(reg.Counter("auth_logins_total", "Number of login attempts by result.", "result"))
+	auth := func(next http.Handler) http.Handler {
+		return j.MWFunc(zerolog.RecordUser(limiter.User(next)))
+	}
+	transport.New(v1, userSvc, auth)
+
+	realIP, err := clientip.New(cfg.Server.TrustedProxies)
+	checkErr(err)
+
+	r := chi.NewRouter()
+	r.Use(
+		requestid.Middleware,
+		realIP,
+		tracer.Middleware,
+		log.Middleware,
+		apperr.Middleware(log),
+		metrics.NewHTTP(reg).Middleware,
+		recovery.New(log),
+		securemw.Headers(secureOptions(cfg.Security)),
+		cors.New(corsOptions(cfg.CORS)),
+		limiter.Middleware,
+	)
+	r.Mount("/v1", v1)
+
+	hc := health.New(log)
+	hc.Add("postgres", health.DB(db), 0)
+	if rc.client != nil {
+		hc.Add("redis", health.Redis(rc.client), 0)
+	}
+	r.Get("/healthz", hc.Live)
+	r.Get("/readyz", hc.Ready)
+	if cfg.Metrics.Username != "" && cfg.Metrics.Password != "" {
+		r.With(basicauth.New(cfg.Metrics.Username, cfg.Metrics.Password, "Metrics")).Method("GET", "/metrics", reg.Handler())
+	}
+
+	if cfg.OpenAPI.Username != "" && cfg.OpenAPI.Password != "" {
+		doc := openapi.New("chisk", "1.0.0")
+		transport.Document(doc, "/v1")
+		r.Route("/docs", func(r chi.Router) {
+			r.Use(basicauth.New(cfg.OpenAPI.Username, cfg.OpenAPI.Password, "API docs"))
+			r.Method("GET", "/openapi.json", doc)
+			r.Method("GET", "/*", openapi.UI("/docs/openapi.json"))
+		})
+	}
+
+	srv := &http.Server{
+		Addr:         cfg.Server.Port,
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		c, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(c)
+	}()
+
+	if err := listen(srv, cfg.Server); err != http.ErrServerClosed {
+		checkErr(err)
+	}
+}
 
-	http.ListenAndServe(":8080", nil)
+// shutdownTimeout is how long in-flight requests are given to complete on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// listen serves srv over TLS if certificate is configured, redirecting plain HTTP requests if set,
+// and over plain HTTP otherwise
+func listen(srv *http.Server, cfg config.Server) error {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return srv.ListenAndServe()
+	}
+
+	if cfg.HTTPRedirectPort != "" {
+		go func() {
+			checkErr((&http.Server{
+				Addr:         cfg.HTTPRedirectPort,
+				Handler:      securemw.RedirectHTTPS(cfg.Port),
+				ReadTimeout:  srv.ReadTimeout,
+				WriteTimeout: srv.WriteTimeout,
+			}).ListenAndServe())
+		}()
+	}
+	return srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+}
+
+// logOptions converts logging configuration to logger options
+func logOptions(cfg config.Log) zerolog.Options {
+	return zerolog.Options{
+		Level:      cfg.Level,
+		Format:     cfg.Format,
+		SampleInfo: cfg.SampleInfo,
+		File:       cfg.File,
+		MaxSizeMB:  cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		Redact: zerolog.RedactOptions{
+			Fields:   cfg.Redact.Fields,
+			Patterns: cfg.Redact.Patterns,
+			HashKey:  cfg.Redact.HashKey,
+		},
+	}
+}
+
+// dbOptions converts database configuration to connection options
+func dbOptions(cfg config.Database, log pgsql.Logger) pgsql.Options {
+	return pgsql.Options{
+		LogQueries:         cfg.LogQueries,
+		SlowQueryThreshold: time.Duration(cfg.SlowQueryThresholdMs) * time.Millisecond,
+		Logger:             log,
+		Timeout:            time.Duration(cfg.TimeoutSeconds) * time.Second,
+		PoolSize:           cfg.PoolSize,
+		MinIdleConns:       cfg.MinIdleConns,
+		IdleTimeout:        time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+		MaxConnAge:         time.Duration(cfg.MaxConnAgeSeconds) * time.Second,
+		PoolTimeout:        time.Duration(cfg.PoolTimeoutSeconds) * time.Second,
+		StatementTimeout:   time.Duration(cfg.StatementTimeoutSeconds) * time.Second,
+	}
+}
+
+// redisClient connects to Redis once, when the first component configured to use it asks for a client
+type redisClient struct {
+	cfg     config.Redis
+	metrics *metrics.Redis
+	client  *goredis.Client
+}
+
+func (c *redisClient) get() (*goredis.Client, error) {
+	if c.client == nil {
+		client, err := redis.New(c.cfg.Address, c.cfg.Password, c.cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		c.metrics.Instrument(client)
+		c.client = client
+	}
+	return c.client, nil
+}
+
+// sessionStore creates session store selected in configuration
+func sessionStore(cfg *config.Configuration, db *pg.DB, rc *redisClient) (session.Store, error) {
+	switch cfg.Session.Store {
+	case "", "redis":
+		client, err := rc.get()
+		if err != nil {
+			return nil, err
+		}
+		return session.NewRedisStore(client), nil
+	case "postgres":
+		return session.NewPGStore(db), nil
+	case "memory":
+		return session.NewMemoryStore(time.Duration(cfg.Session.CleanupInterval) * time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", cfg.Session.Store)
+	}
+}
+
+// newTracer creates tracer exporting spans to exporter selected in configuration
+func newTracer(cfg config.Trace, log trace.Logger) (*trace.Tracer, error) {
+	var exp trace.Exporter
+	switch cfg.Exporter {
+	case "":
+	case "otlp":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("trace endpoint is not configured")
+		}
+		exp = trace.NewOTLPExporter(cfg.Endpoint, cfg.ServiceName)
+	case "stdout":
+		exp = trace.NewWriterExporter(os.Stdout)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	return trace.New(exp, log, trace.Options{
+		ServiceName: cfg.ServiceName,
+		SampleRatio: cfg.SampleRatio,
+	}), nil
+}
+
+func corsOptions(cfg config.CORS) cors.Options {
+	return cors.Options{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           time.Duration(cfg.MaxAge) * time.Second,
+	}
+}
+
+func secureOptions(cfg config.Security) securemw.Options {
+	return securemw.Options{
+		HSTSMaxAge:            time.Duration(cfg.HSTSMaxAge) * time.Second,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		HSTSPreload:           cfg.HSTSPreload,
+		FrameOptions:          cfg.FrameOptions,
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		TrustForwardedProto:   cfg.TrustForwardedProto,
+	}
+}
+
+// rateLimitStore creates rate limit store selected in configuration
+func rateLimitStore(cfg *config.Configuration, rc *redisClient) (ratelimit.Store, error) {
+	switch cfg.RateLimit.Store {
+	case "", "memory":
+		return ratelimit.NewMemoryStore(time.Duration(cfg.RateLimit.CleanupInterval) * time.Second), nil
+	case "redis":
+		client, err := rc.get()
+		if err != nil {
+			return nil, err
+		}
+		return ratelimit.NewRedisStore(client), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimit.Store)
+	}
+}
+
+func rateLimitRules(cfg config.RateLimit) []ratelimit.Rule {
+	rules := make([]ratelimit.Rule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		rules[i] = ratelimit.Rule{
+			Name:   r.Name,
+			Method: r.Method,
+			Path:   r.Path,
+			Key:    ratelimit.Key(r.Key),
+			Limit: ratelimit.Limit{
+				Algorithm: ratelimit.Algorithm(r.Algorithm),
+				Requests:  r.Requests,
+				Window:    time.Duration(r.Window) * time.Second,
+				Burst:     r.Burst,
+			},
+		}
+	}
+	return rules
+}
 
+func checkErr(err error) {
+	if err != nil {
+		panic(err.Error())
+	}
 }
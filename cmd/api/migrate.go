@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ribice/chisk/internal/migrations"
+	"github.com/ribice/chisk/pkg/config"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/postgres/migrate"
+	"github.com/ribice/chisk/pkg/zerolog"
+)
+
+const migrateUsage = `usage: api [-p config] [-m dir] migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down [n]     roll back n most recent migrations (default 1)
+  status       list migrations and whether they are applied
+  create name  create new migration files in dir`
+
+// runMigrate runs migrate subcommand
+func runMigrate(cfgPath, dir string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return fmt.Errorf(migrateUsage)
+		}
+		up, down, err := migrate.Create(dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return nil
+	}
+
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	log, err := zerolog.New(logOptions(cfg.Log))
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	opts := dbOptions(cfg.DB, log)
+	// Migrations may legitimately run longer than regular statements
+	opts.StatementTimeout = 0
+	db, err := pgsql.New(cfg.DB.PSN, opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		if err != nil {
+			return err
+		}
+		printMigrations("applied", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		rolledBack, err := m.Down(steps)
+		if err != nil {
+			return err
+		}
+		printMigrations("rolled back", rolledBack)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	default:
+		return fmt.Errorf(migrateUsage)
+	}
+
+	return nil
+}
+
+func printMigrations(action string, ms []migrate.Migration) {
+	if len(ms) == 0 {
+		fmt.Println("no migrations to run")
+	}
+	for _, m := range ms {
+		fmt.Printf("%s %04d_%s\n", action, m.Version, m.Name)
+	}
+}
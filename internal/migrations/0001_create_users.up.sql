@@ -0,0 +1,18 @@
+CREATE TABLE users (
+	id                   TEXT PRIMARY KEY,
+	created_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+	deleted_at           TIMESTAMPTZ,
+	email                TEXT NOT NULL,
+	display_name         TEXT NOT NULL DEFAULT '',
+	first_name           TEXT NOT NULL DEFAULT '',
+	last_name            TEXT NOT NULL DEFAULT '',
+	password             TEXT NOT NULL,
+	phone_number         TEXT,
+	token                TEXT,
+	is_active            BOOLEAN NOT NULL DEFAULT FALSE,
+	role                 INTEGER NOT NULL,
+	last_password_change TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX users_email_key ON users (lower(email)) WHERE deleted_at IS NULL;
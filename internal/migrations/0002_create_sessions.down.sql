@@ -0,0 +1,2 @@
+DROP TABLE session_index;
+DROP TABLE sessions;
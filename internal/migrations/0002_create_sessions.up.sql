@@ -0,0 +1,13 @@
+CREATE TABLE sessions (
+	key        TEXT PRIMARY KEY,
+	value      BYTEA NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
+
+CREATE TABLE session_index (
+	key    TEXT NOT NULL,
+	member TEXT NOT NULL,
+	PRIMARY KEY (key, member)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE verifications (
+	id         TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	deleted_at TIMESTAMPTZ,
+	user_id    TEXT NOT NULL REFERENCES users (id),
+	token      TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,9 @@
+CREATE TABLE audit_log (
+	id         BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	actor_id   TEXT,
+	user_id    TEXT NOT NULL,
+	action     TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_user_id_idx ON audit_log (user_id);
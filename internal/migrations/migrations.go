@@ -0,0 +1,10 @@
+// Package migrations holds database schema migrations, embedded into the binary.
+// New migrations are created with `api migrate create <name>`.
+package migrations
+
+import "embed"
+
+// FS contains versioned up and down SQL migrations
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,70 @@
+// Package pgsql contains user repository backed by postgres.
+// Writes go to the primary database, joining the transaction carried in context, if any, while lists are read from replicas.
+package pgsql
+
+import (
+	"context"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ribice/chisk/internal/user"
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+// uniqueViolation is SQLSTATE of unique constraint violations, e.g. on users' email index
+const uniqueViolation = "23505"
+
+// New creates new user repository
+func New(db *pgsql.Cluster) *User {
+	return &User{db: db, repo: pgsql.NewRepository(db)}
+}
+
+// User represents user repository
+type User struct {
+	db   *pgsql.Cluster
+	repo *pgsql.Repository
+}
+
+// Create inserts new user
+func (u *User) Create(c context.Context, usr *chisk.User) error {
+	err := u.db.Write(c).Insert(usr)
+	if pgErr, ok := err.(pg.Error); ok && pgErr.Field('C') == uniqueViolation {
+		return user.ErrEmailTaken
+	}
+	return err
+}
+
+// CreateVerification inserts new verification token
+func (u *User) CreateVerification(c context.Context, v *chisk.Verification) error {
+	return u.db.Write(c).Insert(v)
+}
+
+// CreateAuditEntry inserts new audit log entry
+func (u *User) CreateAuditEntry(c context.Context, e *chisk.AuditEntry) error {
+	return u.db.Write(c).Insert(e)
+}
+
+// FindByEmail returns user registered with email, ignoring case, or pg.ErrNoRows.
+// It reads from the primary so that users can log in right after registering.
+func (u *User) FindByEmail(c context.Context, email string) (*chisk.User, error) {
+	usr := new(chisk.User)
+	err := u.db.Write(c).Model(usr).
+		Where("lower(?TableAlias.email) = lower(?)", email).
+		Apply(pgsql.ExcludeDeleted.Apply).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+// List returns users matching q
+func (u *User) List(c context.Context, q pgsql.ListQuery) ([]chisk.User, *pgsql.Page, error) {
+	var users []chisk.User
+	page, err := u.repo.List(c, &users, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return users, page, nil
+}
@@ -1,14 +1,32 @@
 package transport
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/ribice/chisk/internal/user"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/middleware/clientip"
+	"github.com/ribice/chisk/pkg/postgres"
 )
 
-// New instantates user http transport
-func New(r *chi.Mux, svc *user.Service) {
+// New instantates user http transport.
+// Registration and login are public, while other routes require authentication by auth middleware.
+func New(r *chi.Mux, svc *user.Service, auth func(http.Handler) http.Handler) {
+	s := Service{svc: svc}
+	r.Post("/login", s.login)
+	r.Route("/users", func(r chi.Router) {
+		r.Post("/", s.create)
+		r.Group(func(r chi.Router) {
+			r.Use(auth)
+			r.Get("/", s.list)
+			r.Get("/me/sessions", s.listSessions)
+			r.Delete("/me/sessions", s.signOutEverywhere)
+			r.Delete("/{id}/sessions", s.killSessions)
+		})
+	})
 }
 
 // Service represents user http service
@@ -16,5 +34,92 @@ type Service struct {
 	svc *user.Service
 }
 
+// create registers new user
 func (s *Service) create(w http.ResponseWriter, r *http.Request) {
+	var req registerReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperr.Write(w, r, apperr.ErrBadRequest.Wrap(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	u := req.user()
+	if _, err := s.svc.Register(r.Context(), u); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+// login starts new session, returning its access token
+func (s *Service) login(w http.ResponseWriter, r *http.Request) {
+	var req loginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apperr.Write(w, r, apperr.ErrBadRequest.Wrap(err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+
+	token, err := s.svc.Login(r.Context(), strings.TrimSpace(req.Email), req.Password, clientip.FromRequest(r), r.UserAgent())
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResp{Token: token})
+}
+
+// list returns users, filtered, sorted and paginated by query params
+func (s *Service) list(w http.ResponseWriter, r *http.Request) {
+	q, err := pgsql.ParseListQuery(r.URL.Query(), user.ListSpec)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	users, page, err := s.svc.List(r.Context(), q)
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listUsersResp{Users: users, Page: page})
+}
+
+// listSessions returns active sessions of the authenticated user
+func (s *Service) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.svc.ListSessions(r.Context())
+	if err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listSessionsResp{Sessions: sessions})
+}
+
+// signOutEverywhere revokes all sessions of the authenticated user.
+// With keep_current=true query param, the current session is kept.
+func (s *Service) signOutEverywhere(w http.ResponseWriter, r *http.Request) {
+	keepCurrent := r.URL.Query().Get("keep_current") == "true"
+	if err := s.svc.SignOutEverywhere(r.Context(), keepCurrent); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// killSessions revokes all sessions of a user
+func (s *Service) killSessions(w http.ResponseWriter, r *http.Request) {
+	if err := s.svc.KillSessions(r.Context(), chi.URLParam(r, "id")); err != nil {
+		apperr.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,174 @@
+package transport
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ribice/chisk/internal/user"
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/openapi"
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+// Document adds routes registered by New, mounted under prefix, to API document.
+// Request and response schemas are derived from the types handlers decode and encode.
+func Document(d *openapi.Document, prefix string) {
+	d.Components.SecuritySchemes["bearer"] = &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	}
+	auth := []openapi.SecurityRequirement{{"bearer": {}}}
+
+	var (
+		badRequest   = d.JSONResponse("Invalid request", apperr.Error{})
+		unauthorized = d.JSONResponse("Missing or invalid token", apperr.Error{})
+		forbidden    = d.JSONResponse("Available to admins only", apperr.Error{})
+	)
+
+	d.Add("POST", prefix+"/login", &openapi.Operation{
+		Summary:     "Log in",
+		Description: "Starts new session for the user, returning its bearer token.",
+		OperationID: "login",
+		Tags:        []string{"sessions"},
+		RequestBody: d.JSONBody("User's credentials", loginReq{}),
+		Responses: map[string]*openapi.Response{
+			"200": d.JSONResponse("Access token of the new session", loginResp{}),
+			"400": badRequest,
+			"401": d.JSONResponse("Invalid email or password", apperr.Error{}),
+			"403": d.JSONResponse("User is not active", apperr.Error{}),
+		},
+	})
+
+	d.Add("POST", prefix+"/users/", &openapi.Operation{
+		Summary:     "Register user",
+		OperationID: "registerUser",
+		Tags:        []string{"users"},
+		RequestBody: d.JSONBody("New user's details", registerReq{}),
+		Responses: map[string]*openapi.Response{
+			"201": d.JSONResponse("Registered user", chisk.User{}),
+			"400": badRequest,
+			"409": d.JSONResponse("Email already in use", apperr.Error{}),
+		},
+	})
+
+	d.Add("GET", prefix+"/users/", &openapi.Operation{
+		Summary:     "List users",
+		Description: "Lists users, filtered, sorted and paginated by query parameters. Available to admins only.",
+		OperationID: "listUsers",
+		Tags:        []string{"users"},
+		Parameters:  listParams(user.ListSpec),
+		Responses: map[string]*openapi.Response{
+			"200": d.JSONResponse("Page of users", listUsersResp{}),
+			"400": badRequest,
+			"401": unauthorized,
+			"403": forbidden,
+		},
+		Security: auth,
+	})
+
+	d.Add("GET", prefix+"/users/me/sessions", &openapi.Operation{
+		Summary:     "List own sessions",
+		OperationID: "listSessions",
+		Tags:        []string{"sessions"},
+		Responses: map[string]*openapi.Response{
+			"200": d.JSONResponse("Active sessions of the authenticated user", listSessionsResp{}),
+			"401": unauthorized,
+		},
+		Security: auth,
+	})
+
+	d.Add("DELETE", prefix+"/users/me/sessions", &openapi.Operation{
+		Summary:     "Sign out everywhere",
+		Description: "Revokes all sessions of the authenticated user.",
+		OperationID: "signOutEverywhere",
+		Tags:        []string{"sessions"},
+		Parameters: []openapi.Parameter{{
+			Name:        "keep_current",
+			In:          "query",
+			Description: "Keeps the session making the request active",
+			Schema:      &openapi.Schema{Type: "boolean", Default: false},
+		}},
+		Responses: map[string]*openapi.Response{
+			"204": d.JSONResponse("Sessions revoked", nil),
+			"401": unauthorized,
+		},
+		Security: auth,
+	})
+
+	d.Add("DELETE", prefix+"/users/{id}/sessions", &openapi.Operation{
+		Summary:     "Kill user's sessions",
+		Description: "Revokes all sessions of a user. Available to admins only.",
+		OperationID: "killSessions",
+		Tags:        []string{"sessions"},
+		Responses: map[string]*openapi.Response{
+			"204": d.JSONResponse("Sessions revoked", nil),
+			"401": unauthorized,
+			"403": forbidden,
+		},
+		Security: auth,
+	})
+}
+
+// listParams documents query parameters accepted by pgsql.ParseListQuery for spec
+func listParams(spec pgsql.ListSpec) []openapi.Parameter {
+	defaultSort := spec.DefaultSort
+	if defaultSort == "" {
+		defaultSort = "-created_at"
+	}
+	sortable := append([]string{strings.TrimPrefix(defaultSort, "-")}, spec.Sortable...)
+	var sortValues []interface{}
+	seen := make(map[string]bool)
+	for _, f := range sortable {
+		if !seen[f] {
+			seen[f] = true
+			sortValues = append(sortValues, f, "-"+f)
+		}
+	}
+
+	minLimit, maxLimit := float64(1), float64(pgsql.MaxLimit)
+	params := []openapi.Parameter{
+		{Name: "sort", In: "query", Description: "Field to sort by, descending if prefixed with -",
+			Schema: &openapi.Schema{Type: "string", Enum: sortValues, Default: defaultSort}},
+		{Name: "limit", In: "query", Description: "Page size",
+			Schema: &openapi.Schema{Type: "integer", Minimum: &minLimit, Maximum: &maxLimit, Default: pgsql.DefaultLimit}},
+		{Name: "offset", In: "query", Description: "Number of rows to skip, exclusive with cursor",
+			Schema: &openapi.Schema{Type: "integer", Minimum: new(float64)}},
+		{Name: "cursor", In: "query", Description: "next_cursor of the previous page",
+			Schema: &openapi.Schema{Type: "string"}},
+	}
+
+	fields := make([]string, 0, len(spec.Filterable))
+	for f := range spec.Filterable {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		ft := spec.Filterable[f]
+		ops := make([]string, len(ft.Ops()))
+		for i, op := range ft.Ops() {
+			ops[i] = string(op)
+		}
+		params = append(params, openapi.Parameter{
+			Name:        f,
+			In:          "query",
+			Description: "Filters by equality, or by operator given as " + f + "[op], one of " + strings.Join(ops, ", "),
+			Schema:      filterSchema(ft),
+		})
+	}
+	return params
+}
+
+func filterSchema(t pgsql.FieldType) *openapi.Schema {
+	switch t {
+	case pgsql.Int:
+		return &openapi.Schema{Type: "integer"}
+	case pgsql.Bool:
+		return &openapi.Schema{Type: "boolean"}
+	case pgsql.Time:
+		return &openapi.Schema{Type: "string", Format: "date-time"}
+	default:
+		return &openapi.Schema{Type: "string"}
+	}
+}
@@ -0,0 +1,44 @@
+package transport_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/internal/user/transport"
+	"github.com/ribice/chisk/pkg/openapi"
+)
+
+func TestDocument(t *testing.T) {
+	r := chi.NewRouter()
+	transport.New(r, nil, func(next http.Handler) http.Handler { return next })
+
+	d := openapi.New("chisk", "1.0.0")
+	transport.Document(d, "/v1")
+
+	routes := 0
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// Walk joins patterns of subrouters mounted by Route with their wildcard
+		route = strings.Replace(route, "/*/", "/", -1)
+		routes++
+		assert.NotNil(t, d.Operation(method, "/v1"+route), "%s %s is not documented", method, route)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	documented := 0
+	for _, item := range d.Paths {
+		documented += len(*item)
+	}
+	assert.Equal(t, routes, documented, "documented operations match registered routes")
+}
+
+func TestDocumentRequired(t *testing.T) {
+	d := openapi.New("chisk", "1.0.0")
+	transport.Document(d, "/v1")
+
+	assert.Equal(t, []string{"email", "password"}, d.Components.Schemas["registerReq"].Required)
+}
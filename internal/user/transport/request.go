@@ -1,17 +1,65 @@
 package transport
 
 import (
-	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
 )
 
-// CreateReq contains user registration request
-type CreateReq struct {
-	Email           string `json:"email" validate:"required,email"`
-	Password        string `json:"password" validate:"required,min=8"`
-	PasswordConfirm string `json:"password_confirm" validate:"required"`
+// registerReq contains new user's details.
+// Fields tagged validate:"required" are checked by validate and marked required in the API document.
+type registerReq struct {
+	Email       string `json:"email" validate:"required"`
+	Password    string `json:"password" validate:"required"`
+	DisplayName string `json:"display_name"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+func (r registerReq) validate() error {
+	var details []apperr.FieldError
+	if _, err := mail.ParseAddress(r.Email); err != nil {
+		details = append(details, apperr.FieldError{Field: "email", Message: "must be a valid email address"})
+	}
+	if len(r.Password) < 8 {
+		details = append(details, apperr.FieldError{Field: "password", Message: "must be at least 8 characters long"})
+	}
+	if details != nil {
+		return apperr.Validation(details...)
+	}
+	return nil
+}
+
+func (r registerReq) user() *chisk.User {
+	return &chisk.User{
+		Email:       strings.TrimSpace(r.Email),
+		Password:    r.Password,
+		DisplayName: r.DisplayName,
+		FirstName:   r.FirstName,
+		LastName:    r.LastName,
+		PhoneNumber: r.PhoneNumber,
+	}
+}
+
+// loginReq contains user's credentials
+type loginReq struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
-// Bind binds CreateReq
-func (x *CreateReq) Bind(r *http.Request) error {
+func (r loginReq) validate() error {
+	var details []apperr.FieldError
+	if strings.TrimSpace(r.Email) == "" {
+		details = append(details, apperr.FieldError{Field: "email", Message: "is required"})
+	}
+	if r.Password == "" {
+		details = append(details, apperr.FieldError{Field: "password", Message: "is required"})
+	}
+	if details != nil {
+		return apperr.Validation(details...)
+	}
 	return nil
 }
@@ -0,0 +1,23 @@
+package transport
+
+import (
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/session"
+)
+
+// loginResp contains access token of a new session
+type loginResp struct {
+	Token string `json:"token"`
+}
+
+// listUsersResp contains a page of users
+type listUsersResp struct {
+	Users []chisk.User `json:"users"`
+	Page  *pgsql.Page  `json:"page"`
+}
+
+// listSessionsResp contains active sessions of a user
+type listSessionsResp struct {
+	Sessions []*session.Session `json:"sessions"`
+}
@@ -2,9 +2,251 @@ package user
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/jwt"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/session"
 )
 
+// ErrForbidden is returned when authenticated user is not allowed to perform an action
+var ErrForbidden = apperr.ErrForbidden
+
+// ErrEmailTaken is returned when registering with an email already in use
+var ErrEmailTaken = apperr.New(http.StatusConflict, "email_taken", "Email already in use")
+
+// ErrInsecurePassword is returned when registering with a password that is too weak
+var ErrInsecurePassword = apperr.New(http.StatusBadRequest, "insecure_password", "Password is not secure enough")
+
+// ErrInvalidCredentials is returned when logging in with unknown email or wrong password
+var ErrInvalidCredentials = apperr.New(http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+
+// ErrInactiveUser is returned when logging in as a user that has not been activated
+var ErrInactiveUser = apperr.New(http.StatusForbidden, "inactive_user", "User is not active")
+
+// ListSpec whitelists fields users can be listed by
+var ListSpec = pgsql.ListSpec{
+	Sortable: []string{"created_at", "email", "last_name"},
+	Filterable: map[string]pgsql.FieldType{
+		"email":      pgsql.String,
+		"last_name":  pgsql.String,
+		"role":       pgsql.Int,
+		"is_active":  pgsql.Bool,
+		"created_at": pgsql.Time,
+	},
+}
+
+// verificationTTL is how long email verification tokens are valid for
+const verificationTTL = 48 * time.Hour
+
+// New creates new user application service
+func New(sess Sessioner, db DB, tx TxRunner, sec Securer, tg TokenGenerator) *Service {
+	return &Service{sess: sess, db: db, tx: tx, sec: sec, tg: tg}
+}
+
+// Service represents user application service
 type Service struct {
+	sess   Sessioner
+	db     DB
+	tx     TxRunner
+	sec    Securer
+	tg     TokenGenerator
+	logins Counter
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// Counter counts events partitioned by label values
+type Counter interface {
+	Inc(labelValues ...string)
+}
+
+// CountLogins counts login attempts, labeled with success or the error code returned to the client
+func (s *Service) CountLogins(c Counter) {
+	s.logins = c
+}
+
+// DB represents user repository interface
+type DB interface {
+	Create(context.Context, *chisk.User) error
+	CreateVerification(context.Context, *chisk.Verification) error
+	CreateAuditEntry(context.Context, *chisk.AuditEntry) error
+	FindByEmail(context.Context, string) (*chisk.User, error)
+	List(context.Context, pgsql.ListQuery) ([]chisk.User, *pgsql.Page, error)
+}
+
+// Securer represents password security service interface
+type Securer interface {
+	Password(string, ...string) bool
+	Hash(string) string
+	MatchesHash(string, string) bool
+}
+
+// TokenGenerator represents access token generator interface
+type TokenGenerator interface {
+	GenerateToken() (string, error)
+}
+
+// TxRunner represents database transaction runner interface
+type TxRunner interface {
+	RunInTx(context.Context, func(context.Context) error) error
+}
+
+// Sessioner represents session service interface
+type Sessioner interface {
+	ID(string) string
+	Put(*chisk.User, string, string) error
+	ListByUser(string) ([]*session.Session, error)
+	RevokeAllForUser(string) error
+	RevokeOthers(string, string) error
+}
+
+// Register creates new inactive user along with an email verification token, recording it in the audit log.
+// Either all of them are stored or none are. Delivering the token to the user is up to the caller.
+func (s *Service) Register(c context.Context, u *chisk.User) (*chisk.Verification, error) {
+	if !s.sec.Password(u.Password, u.Email, u.DisplayName, u.FirstName, u.LastName) {
+		return nil, ErrInsecurePassword
+	}
+	u.Password = s.sec.Hash(u.Password)
+	u.Role = chisk.UserRole
+	u.IsActive = false
+
+	token, err := verificationToken()
+	if err != nil {
+		return nil, err
+	}
+	v := &chisk.Verification{Token: token, ExpiresAt: time.Now().Add(verificationTTL)}
+	actor, _ := c.Value(jwt.UserIDKey).(string)
+
+	err = s.tx.RunInTx(c, func(c context.Context) error {
+		if err := s.db.Create(c, u); err != nil {
+			return err
+		}
+		v.UserID = u.ID
+		if err := s.db.CreateVerification(c, v); err != nil {
+			return err
+		}
+		return s.db.CreateAuditEntry(c, &chisk.AuditEntry{ActorID: actor, UserID: u.ID, Action: "user.registered"})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func verificationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Login checks user's credentials and starts new session for the client at ip, returning its access token
+func (s *Service) Login(c context.Context, email, password, ip, userAgent string) (string, error) {
+	token, err := s.login(c, email, password, ip, userAgent)
+	if s.logins != nil {
+		result := "success"
+		if err != nil {
+			result = "error"
+			if e, ok := err.(*apperr.Error); ok {
+				result = e.Code
+			}
+		}
+		s.logins.Inc(result)
+	}
+	return token, err
+}
+
+func (s *Service) login(c context.Context, email, password, ip, userAgent string) (string, error) {
+	u, err := s.db.FindByEmail(c, email)
+	if err == pg.ErrNoRows {
+		// Password is still compared so that unknown emails can't be told apart by response time
+		s.sec.MatchesHash(s.dummyHash(), password)
+		return "", ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", err
+	}
+	if !s.sec.MatchesHash(u.Password, password) {
+		return "", ErrInvalidCredentials
+	}
+	if !u.IsActive {
+		return "", ErrInactiveUser
+	}
+
+	if u.Token, err = s.tg.GenerateToken(); err != nil {
+		return "", err
+	}
+	if err := s.sess.Put(u, ip, userAgent); err != nil {
+		return "", err
+	}
+	return u.Token, nil
 }
 
-func (s *Service) Create(c context.Context) {}
+// dummyHash returns hash compared against when logging in with unknown email, hashing it on first use
+func (s *Service) dummyHash() string {
+	s.dummyOnce.Do(func() {
+		s.dummy = s.sec.Hash("dummy password")
+	})
+	return s.dummy
+}
+
+// List returns users matching q. Available to admins only.
+func (s *Service) List(c context.Context, q pgsql.ListQuery) ([]chisk.User, *pgsql.Page, error) {
+	if !isAdmin(c) {
+		return nil, nil, ErrForbidden
+	}
+	return s.db.List(c, q)
+}
+
+// ListSessions returns active sessions of the authenticated user
+func (s *Service) ListSessions(c context.Context) ([]*session.Session, error) {
+	id, _ := c.Value(jwt.UserIDKey).(string)
+	sessions, err := s.sess.ListByUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _ := c.Value(jwt.TokenKey).(string)
+	current := s.sess.ID(token)
+	for _, sess := range sessions {
+		sess.Current = sess.ID == current
+	}
+
+	return sessions, nil
+}
+
+// SignOutEverywhere revokes sessions of the authenticated user.
+// If keepCurrent is set, the session making the request stays active.
+func (s *Service) SignOutEverywhere(c context.Context, keepCurrent bool) error {
+	id, _ := c.Value(jwt.UserIDKey).(string)
+	if keepCurrent {
+		token, _ := c.Value(jwt.TokenKey).(string)
+		return s.sess.RevokeOthers(id, token)
+	}
+	return s.sess.RevokeAllForUser(id)
+}
+
+// KillSessions revokes all sessions of the given user. Available to admins only.
+func (s *Service) KillSessions(c context.Context, id string) error {
+	if !isAdmin(c) {
+		return ErrForbidden
+	}
+	return s.sess.RevokeAllForUser(id)
+}
+
+func isAdmin(c context.Context) bool {
+	role, ok := c.Value(jwt.UserRoleKey).(chisk.AccessRole)
+	return ok && role > 0 && role <= chisk.AdminRole
+}
@@ -0,0 +1,383 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg"
+	"github.com/ribice/chisk/internal/user"
+	"github.com/ribice/chisk/mock"
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/jwt"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignOutEverywhere(t *testing.T) {
+	cases := []struct {
+		name        string
+		keepCurrent bool
+		wantAll     string
+		wantOthers  []string
+	}{
+		{
+			name:    "Revoke all sessions",
+			wantAll: "uid",
+		},
+		{
+			name:        "Keep current session",
+			keepCurrent: true,
+			wantOthers:  []string{"uid", "token"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				all    string
+				others []string
+			)
+			svc := user.New(&mock.Session{
+				RevokeAllForUserFn: func(id string) error {
+					all = id
+					return nil
+				},
+				RevokeOthersFn: func(id, token string) error {
+					others = []string{id, token}
+					return nil
+				},
+			}, nil, nil, nil, nil)
+			ctx := context.WithValue(context.Background(), jwt.UserIDKey, "uid")
+			ctx = context.WithValue(ctx, jwt.TokenKey, "token")
+
+			err := svc.SignOutEverywhere(ctx, tt.keepCurrent)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAll, all)
+			assert.Equal(t, tt.wantOthers, others)
+		})
+	}
+}
+
+func TestKillSessions(t *testing.T) {
+	cases := []struct {
+		name    string
+		role    interface{}
+		wantErr error
+	}{
+		{
+			name:    "Missing role",
+			wantErr: user.ErrForbidden,
+		},
+		{
+			name:    "Unset role",
+			role:    chisk.AccessRole(0),
+			wantErr: user.ErrForbidden,
+		},
+		{
+			name:    "Standard user",
+			role:    chisk.UserRole,
+			wantErr: user.ErrForbidden,
+		},
+		{
+			name: "Admin",
+			role: chisk.AdminRole,
+		},
+		{
+			name:    "Session error",
+			role:    chisk.SuperAdminRole,
+			wantErr: mock.ErrGeneric,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := user.New(&mock.Session{
+				RevokeAllForUserFn: func(id string) error {
+					assert.Equal(t, "victim", id)
+					if tt.role == chisk.SuperAdminRole {
+						return mock.ErrGeneric
+					}
+					return nil
+				},
+			}, nil, nil, nil, nil)
+			ctx := context.Background()
+			if tt.role != nil {
+				ctx = context.WithValue(ctx, jwt.UserRoleKey, tt.role)
+			}
+			assert.Equal(t, tt.wantErr, svc.KillSessions(ctx, "victim"))
+		})
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	svc := user.New(&mock.Session{
+		IDFn: func(token string) string {
+			return "session:" + token
+		},
+		ListByUserFn: func(id string) ([]*session.Session, error) {
+			assert.Equal(t, "uid", id)
+			return []*session.Session{
+				{ID: "session:other"},
+				{ID: "session:token"},
+			}, nil
+		},
+	}, nil, nil, nil, nil)
+	ctx := context.WithValue(context.Background(), jwt.UserIDKey, "uid")
+	ctx = context.WithValue(ctx, jwt.TokenKey, "token")
+
+	sessions, err := svc.ListSessions(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*session.Session{
+		{ID: "session:other"},
+		{ID: "session:token", Current: true},
+	}, sessions)
+}
+
+func TestRegister(t *testing.T) {
+	cases := []struct {
+		name     string
+		password string
+		db       *mock.UserDB
+		wantTx   int
+		wantErr  error
+	}{
+		{
+			name:     "Insecure password",
+			password: "weak",
+			wantErr:  user.ErrInsecurePassword,
+		},
+		{
+			name: "Email taken",
+			db: &mock.UserDB{
+				CreateFn: func(context.Context, *chisk.User) error {
+					return user.ErrEmailTaken
+				},
+			},
+			wantTx:  1,
+			wantErr: user.ErrEmailTaken,
+		},
+		{
+			name: "Audit failure",
+			db: &mock.UserDB{
+				CreateFn: func(_ context.Context, u *chisk.User) error {
+					u.ID = "uid"
+					return nil
+				},
+				CreateVerificationFn: func(context.Context, *chisk.Verification) error {
+					return nil
+				},
+				CreateAuditEntryFn: func(context.Context, *chisk.AuditEntry) error {
+					return mock.ErrGeneric
+				},
+			},
+			wantTx:  1,
+			wantErr: mock.ErrGeneric,
+		},
+		{
+			name: "Success",
+			db: &mock.UserDB{
+				CreateFn: func(_ context.Context, u *chisk.User) error {
+					u.ID = "uid"
+					return nil
+				},
+				CreateVerificationFn: func(_ context.Context, v *chisk.Verification) error {
+					assert.Equal(t, "uid", v.UserID)
+					assert.Len(t, v.Token, 64)
+					return nil
+				},
+				CreateAuditEntryFn: func(_ context.Context, e *chisk.AuditEntry) error {
+					assert.Equal(t, &chisk.AuditEntry{ActorID: "admin", UserID: "uid", Action: "user.registered"}, e)
+					return nil
+				},
+			},
+			wantTx: 1,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var inTx int
+			svc := user.New(nil, tt.db, &mock.TxRunner{
+				RunInTxFn: func(c context.Context, fn func(context.Context) error) error {
+					inTx++
+					return fn(c)
+				},
+			}, &mock.Secure{
+				PasswordFn: func(pw string, _ ...string) bool {
+					return pw != "weak"
+				},
+				HashFn: func(pw string) string {
+					return "hashed" + pw
+				},
+			}, nil)
+			ctx := context.WithValue(context.Background(), jwt.UserIDKey, "admin")
+			u := &chisk.User{Email: "john@example.org", Password: "correct horse battery staple"}
+			if tt.password != "" {
+				u.Password = tt.password
+			}
+
+			v, err := svc.Register(ctx, u)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantTx, inTx)
+			if tt.wantErr != nil {
+				assert.Nil(t, v)
+				return
+			}
+			assert.Equal(t, "uid", v.UserID)
+			assert.Equal(t, "hashedcorrect horse battery staple", u.Password)
+			assert.Equal(t, chisk.UserRole, u.Role)
+			assert.False(t, u.IsActive)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	cases := []struct {
+		name      string
+		role      interface{}
+		wantUsers []chisk.User
+		wantErr   error
+	}{
+		{
+			name:    "Unset role",
+			role:    chisk.AccessRole(0),
+			wantErr: user.ErrForbidden,
+		},
+		{
+			name:    "Standard user",
+			role:    chisk.UserRole,
+			wantErr: user.ErrForbidden,
+		},
+		{
+			name:      "Admin",
+			role:      chisk.AdminRole,
+			wantUsers: []chisk.User{{Email: "john@example.org"}},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			q := pgsql.ListQuery{Sort: "email", Limit: 10}
+			svc := user.New(nil, &mock.UserDB{
+				ListFn: func(_ context.Context, lq pgsql.ListQuery) ([]chisk.User, *pgsql.Page, error) {
+					assert.Equal(t, q, lq)
+					return []chisk.User{{Email: "john@example.org"}}, &pgsql.Page{}, nil
+				},
+			}, nil, nil, nil)
+			ctx := context.WithValue(context.Background(), jwt.UserRoleKey, tt.role)
+
+			users, _, err := svc.List(ctx, q)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantUsers, users)
+		})
+	}
+}
+
+type counter map[string]int
+
+func (c counter) Inc(labelValues ...string) {
+	c[labelValues[0]]++
+}
+
+func TestLogin(t *testing.T) {
+	cases := []struct {
+		name       string
+		email      string
+		password   string
+		user       *chisk.User
+		dbErr      error
+		putErr     error
+		wantToken  string
+		wantErr    error
+		wantResult string
+	}{
+		{
+			name:       "Unknown email",
+			email:      "jane@example.org",
+			password:   "secret",
+			dbErr:      pg.ErrNoRows,
+			wantErr:    user.ErrInvalidCredentials,
+			wantResult: "invalid_credentials",
+		},
+		{
+			name:       "Database error",
+			dbErr:      mock.ErrGeneric,
+			wantErr:    mock.ErrGeneric,
+			wantResult: "error",
+		},
+		{
+			name:       "Wrong password",
+			password:   "wrong",
+			user:       &chisk.User{Base: chisk.Base{ID: "uid"}, Password: "hashedsecret", IsActive: true},
+			wantErr:    user.ErrInvalidCredentials,
+			wantResult: "invalid_credentials",
+		},
+		{
+			name:       "Inactive user",
+			password:   "secret",
+			user:       &chisk.User{Base: chisk.Base{ID: "uid"}, Password: "hashedsecret"},
+			wantErr:    user.ErrInactiveUser,
+			wantResult: "inactive_user",
+		},
+		{
+			name:       "Session error",
+			password:   "secret",
+			user:       &chisk.User{Base: chisk.Base{ID: "uid"}, Password: "hashedsecret", IsActive: true},
+			putErr:     mock.ErrGeneric,
+			wantErr:    mock.ErrGeneric,
+			wantResult: "error",
+		},
+		{
+			name:       "Success",
+			password:   "secret",
+			user:       &chisk.User{Base: chisk.Base{ID: "uid"}, Password: "hashedsecret", IsActive: true},
+			wantToken:  "token",
+			wantResult: "success",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				put    *chisk.User
+				hashed []string
+			)
+			svc := user.New(&mock.Session{
+				PutFn: func(u *chisk.User, ip, userAgent string) error {
+					assert.Equal(t, "127.0.0.1", ip)
+					assert.Equal(t, "curl", userAgent)
+					put = u
+					return tt.putErr
+				},
+			}, &mock.UserDB{
+				FindByEmailFn: func(_ context.Context, email string) (*chisk.User, error) {
+					assert.Equal(t, "john@example.org", email)
+					return tt.user, tt.dbErr
+				},
+			}, nil, &mock.Secure{
+				HashFn: func(pw string) string {
+					return "hashed" + pw
+				},
+				MatchesHashFn: func(hash, pw string) bool {
+					hashed = append(hashed, hash)
+					return hash == "hashed"+pw
+				},
+			}, &mock.TokenGenerator{
+				GenerateTokenFn: func() (string, error) {
+					return "token", nil
+				},
+			})
+			logins := counter{}
+			svc.CountLogins(logins)
+
+			token, err := svc.Login(context.Background(), "john@example.org", tt.password, "127.0.0.1", "curl")
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantToken, token)
+			assert.Equal(t, counter{tt.wantResult: 1}, logins)
+			if tt.dbErr == pg.ErrNoRows {
+				assert.Equal(t, []string{"hasheddummy password"}, hashed, "password is compared to dummy hash")
+			}
+			if tt.wantToken != "" || tt.putErr != nil {
+				assert.Equal(t, "token", put.Token)
+			} else {
+				assert.Nil(t, put, "session is not created")
+			}
+		})
+	}
+}
@@ -1,15 +1,48 @@
 package mock
 
 import (
+	"context"
+
 	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/session"
 )
 
 // Session mock
 type Session struct {
-	GetFn func(string) (*chisk.AuthUser, error)
+	GetAndTouchFn      func(context.Context, string, string, string) (*chisk.AuthUser, error)
+	IDFn               func(string) string
+	PutFn              func(*chisk.User, string, string) error
+	ListByUserFn       func(string) ([]*session.Session, error)
+	RevokeAllForUserFn func(string) error
+	RevokeOthersFn     func(string, string) error
+}
+
+// GetAndTouch mock
+func (s *Session) GetAndTouch(ctx context.Context, token, ip, userAgent string) (*chisk.AuthUser, error) {
+	return s.GetAndTouchFn(ctx, token, ip, userAgent)
+}
+
+// ID mock
+func (s *Session) ID(token string) string {
+	return s.IDFn(token)
+}
+
+// Put mock
+func (s *Session) Put(u *chisk.User, ip, userAgent string) error {
+	return s.PutFn(u, ip, userAgent)
+}
+
+// ListByUser mock
+func (s *Session) ListByUser(id string) ([]*session.Session, error) {
+	return s.ListByUserFn(id)
+}
+
+// RevokeAllForUser mock
+func (s *Session) RevokeAllForUser(id string) error {
+	return s.RevokeAllForUserFn(id)
 }
 
-// Get mock
-func (s *Session) Get(token string) (*chisk.AuthUser, error) {
-	return s.GetFn(token)
+// RevokeOthers mock
+func (s *Session) RevokeOthers(id, token string) error {
+	return s.RevokeOthersFn(id, token)
 }
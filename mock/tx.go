@@ -0,0 +1,16 @@
+package mock
+
+import "context"
+
+// TxRunner mock, running fn directly unless RunInTxFn is set
+type TxRunner struct {
+	RunInTxFn func(context.Context, func(context.Context) error) error
+}
+
+// RunInTx mock
+func (t *TxRunner) RunInTx(c context.Context, fn func(context.Context) error) error {
+	if t.RunInTxFn != nil {
+		return t.RunInTxFn(c, fn)
+	}
+	return fn(c)
+}
@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+// UserDB mock
+type UserDB struct {
+	CreateFn             func(context.Context, *chisk.User) error
+	CreateVerificationFn func(context.Context, *chisk.Verification) error
+	CreateAuditEntryFn   func(context.Context, *chisk.AuditEntry) error
+	FindByEmailFn        func(context.Context, string) (*chisk.User, error)
+	ListFn               func(context.Context, pgsql.ListQuery) ([]chisk.User, *pgsql.Page, error)
+}
+
+// Create mock
+func (u *UserDB) Create(c context.Context, usr *chisk.User) error {
+	return u.CreateFn(c, usr)
+}
+
+// CreateVerification mock
+func (u *UserDB) CreateVerification(c context.Context, v *chisk.Verification) error {
+	return u.CreateVerificationFn(c, v)
+}
+
+// CreateAuditEntry mock
+func (u *UserDB) CreateAuditEntry(c context.Context, e *chisk.AuditEntry) error {
+	return u.CreateAuditEntryFn(c, e)
+}
+
+// FindByEmail mock
+func (u *UserDB) FindByEmail(c context.Context, email string) (*chisk.User, error) {
+	return u.FindByEmailFn(c, email)
+}
+
+// List mock
+func (u *UserDB) List(c context.Context, q pgsql.ListQuery) ([]chisk.User, *pgsql.Page, error) {
+	return u.ListFn(c, q)
+}
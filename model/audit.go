@@ -0,0 +1,24 @@
+package chisk
+
+import (
+	"time"
+
+	"github.com/go-pg/pg/orm"
+)
+
+// AuditEntry records an action performed on behalf of a user
+type AuditEntry struct {
+	tableName struct{} `sql:"audit_log"`
+
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	UserID    string    `json:"user_id"`
+	Action    string    `json:"action"`
+}
+
+// BeforeInsert hooks into insert operations
+func (a *AuditEntry) BeforeInsert(_ orm.DB) error {
+	a.CreatedAt = time.Now()
+	return nil
+}
@@ -29,3 +29,8 @@ func (b *Base) BeforeUpdate(_ orm.DB) error {
 	b.UpdatedAt = time.Now()
 	return nil
 }
+
+// SetDeletedAt sets the time model was soft deleted at, nil marking it as not deleted
+func (b *Base) SetDeletedAt(t *time.Time) {
+	b.DeletedAt = t
+}
@@ -0,0 +1,11 @@
+package chisk
+
+import "time"
+
+// Verification represents email verification token issued to a user
+type Verification struct {
+	Base
+	UserID    string    `json:"user_id"`
+	Token     string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
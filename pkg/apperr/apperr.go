@@ -0,0 +1,174 @@
+// Package apperr provides API error type rendered as JSON, along with mapping of database errors.
+package apperr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-pg/pg"
+)
+
+// Postgres SQLSTATE codes mapped to client errors
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+	invalidTextRep      = "22P02"
+)
+
+// Common errors
+var (
+	ErrBadRequest   = New(http.StatusBadRequest, "bad_request", "Bad request")
+	ErrUnauthorized = New(http.StatusUnauthorized, "unauthorized", "Unauthorized")
+	ErrForbidden    = New(http.StatusForbidden, "forbidden", "Forbidden")
+	ErrNotFound     = New(http.StatusNotFound, "not_found", "Resource not found")
+	ErrConflict     = New(http.StatusConflict, "conflict", "Resource already exists")
+	ErrInternal     = New(http.StatusInternalServerError, "internal", "Internal server error")
+)
+
+// Error represents API error
+type Error struct {
+	// Status is HTTP status code
+	Status int `json:"-"`
+
+	// Code is machine-readable error code, e.g. email_taken
+	Code string `json:"code"`
+
+	// Message is human-readable error message
+	Message string `json:"message"`
+
+	// Details describe invalid fields
+	Details []FieldError `json:"details,omitempty"`
+
+	// Err is the underlying error, never exposed to clients
+	Err error `json:"-"`
+}
+
+// FieldError describes why a field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// New creates new API error
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Validation creates bad request error describing invalid fields
+func Validation(details ...FieldError) *Error {
+	e := New(http.StatusBadRequest, "validation_failed", "Request validation failed")
+	e.Details = details
+	return e
+}
+
+// Error implements error interface
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns copy of e with err as the underlying error
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// From converts err to API error. Database errors are mapped to client errors where possible,
+// e.g. pg.ErrNoRows to 404 and unique violations to 409. Unknown errors become internal errors.
+// Packages returning errors clients can act on should return or wrap *Error instead of extending this mapping.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	if errors.Is(err, pg.ErrNoRows) {
+		return ErrNotFound.Wrap(err)
+	}
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		switch pgErr.Field('C') {
+		case uniqueViolation:
+			return ErrConflict.Wrap(err)
+		case foreignKeyViolation:
+			return New(http.StatusConflict, "reference_violation", "Referenced resource does not exist or is still referenced").Wrap(err)
+		case invalidTextRep:
+			return ErrBadRequest.Wrap(err)
+		}
+	}
+
+	return ErrInternal.Wrap(err)
+}
+
+// problem represents RFC 7807 problem details
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Details  []FieldError `json:"details,omitempty"`
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
+}
+
+type loggerKey struct{}
+
+// Middleware makes Write log causes of server errors to log, as clients only get a generic message.
+// The logger is carried in request context.
+func Middleware(log Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, log)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Write renders err as JSON. Clients accepting application/problem+json get RFC 7807 problem details.
+// Causes of server errors are logged along with the request, if the request went through Middleware.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+
+	if e.Status >= http.StatusInternalServerError && e.Err != nil && r != nil {
+		if log, ok := r.Context().Value(loggerKey{}).(Logger); ok {
+			params := map[string]interface{}{"status": e.Status, "code": e.Code, "method": r.Method, "path": r.URL.Path}
+			log.Log(r.Context(), "apperr", "Request failed", e.Err, params)
+		}
+	}
+
+	if r != nil && strings.Contains(r.Header.Get("Accept"), "application/problem+json") {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(e.Status),
+			Status:   e.Status,
+			Detail:   e.Message,
+			Instance: r.URL.Path,
+			Code:     e.Code,
+			Details:  e.Details,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
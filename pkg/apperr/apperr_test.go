@@ -0,0 +1,152 @@
+package apperr_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-pg/pg"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/apperr"
+)
+
+type pgError string
+
+func (e pgError) Error() string { return "pg error " + string(e) }
+
+func (e pgError) Field(f byte) string {
+	if f == 'C' {
+		return string(e)
+	}
+	return ""
+}
+
+func (e pgError) IntegrityViolation() bool { return false }
+
+func TestFrom(t *testing.T) {
+	emailTaken := apperr.New(http.StatusConflict, "email_taken", "Email already in use")
+	cases := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "API error", err: emailTaken, wantStatus: http.StatusConflict, wantCode: "email_taken"},
+		{name: "Wrapped API error", err: fmt.Errorf("registering: %w", emailTaken), wantStatus: http.StatusConflict, wantCode: "email_taken"},
+		{name: "No rows", err: pg.ErrNoRows, wantStatus: http.StatusNotFound, wantCode: "not_found"},
+		{name: "Unique violation", err: pgError("23505"), wantStatus: http.StatusConflict, wantCode: "conflict"},
+		{name: "Foreign key violation", err: pgError("23503"), wantStatus: http.StatusConflict, wantCode: "reference_violation"},
+		{name: "Unknown error", err: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantCode: "internal"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			e := apperr.From(tt.err)
+			assert.Equal(t, tt.wantStatus, e.Status)
+			assert.Equal(t, tt.wantCode, e.Code)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	cases := []struct {
+		name            string
+		accept          string
+		err             error
+		wantStatus      int
+		wantContentType string
+		wantBody        map[string]interface{}
+	}{
+		{
+			name:            "JSON",
+			err:             apperr.Validation(apperr.FieldError{Field: "email", Message: "is required"}),
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/json",
+			wantBody: map[string]interface{}{
+				"code":    "validation_failed",
+				"message": "Request validation failed",
+				"details": []interface{}{map[string]interface{}{"field": "email", "message": "is required"}},
+			},
+		},
+		{
+			name:            "Internal errors are not exposed",
+			err:             errors.New("connection refused"),
+			wantStatus:      http.StatusInternalServerError,
+			wantContentType: "application/json",
+			wantBody:        map[string]interface{}{"code": "internal", "message": "Internal server error"},
+		},
+		{
+			name:            "Problem details",
+			accept:          "application/problem+json",
+			err:             pg.ErrNoRows,
+			wantStatus:      http.StatusNotFound,
+			wantContentType: "application/problem+json",
+			wantBody: map[string]interface{}{
+				"type":     "about:blank",
+				"title":    "Not Found",
+				"status":   float64(http.StatusNotFound),
+				"detail":   "Resource not found",
+				"instance": "/users/42",
+				"code":     "not_found",
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/42", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+
+			apperr.Write(rec, req, tt.err)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			var body map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantBody, body)
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	cause := errors.New("cause")
+	e := apperr.ErrNotFound.Wrap(cause)
+	assert.True(t, errors.Is(e, cause))
+	assert.Nil(t, apperr.ErrNotFound.Err, "wrapping does not modify the original")
+	assert.Equal(t, "Resource not found: cause", e.Error())
+}
+
+// logger records logged errors
+type logger struct {
+	errs   []error
+	params []map[string]interface{}
+}
+
+func (l *logger) Log(_ context.Context, source, msg string, err error, params map[string]interface{}) {
+	l.errs = append(l.errs, err)
+	l.params = append(l.params, params)
+}
+
+func TestWriteLogs(t *testing.T) {
+	log := &logger{}
+	cause := errors.New("connection refused")
+	for _, err := range []error{cause, apperr.ErrNotFound, apperr.ErrInternal, pg.ErrNoRows} {
+		h := apperr.Middleware(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apperr.Write(w, r, err)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+	}
+	apperr.Write(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil), cause)
+
+	assert.Equal(t, []error{cause}, log.errs, "only causes of server errors within Middleware are logged")
+	assert.Equal(t, []map[string]interface{}{{
+		"status": http.StatusInternalServerError,
+		"code":   "internal",
+		"method": "GET",
+		"path":   "/users/42",
+	}}, log.params)
+}
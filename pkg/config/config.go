@@ -24,18 +24,37 @@ func Load(path string) (*Configuration, error) {
 
 // Configuration holds application configuration data
 type Configuration struct {
-	Server  Server      `yaml:"server,omitempty"`
-	DB      Database    `yaml:"database,omitempty"`
-	JWT     JWT         `yaml:"jwt,omitempty"`
-	App     Application `yaml:"application,omitempty"`
-	OpenAPI OpenAPI     `yaml:"openapi,omitempty"`
+	Server    Server      `yaml:"server,omitempty"`
+	DB        Database    `yaml:"database,omitempty"`
+	JWT       JWT         `yaml:"jwt,omitempty"`
+	App       Application `yaml:"application,omitempty"`
+	OpenAPI   OpenAPI     `yaml:"openapi,omitempty"`
+	Redis     Redis       `yaml:"redis,omitempty"`
+	Session   Session     `yaml:"session,omitempty"`
+	Log       Log         `yaml:"log,omitempty"`
+	RateLimit RateLimit   `yaml:"rate_limit,omitempty"`
+	CORS      CORS        `yaml:"cors,omitempty"`
+	Security  Security    `yaml:"security,omitempty"`
+	Trace     Trace       `yaml:"trace,omitempty"`
+	Metrics   Metrics     `yaml:"metrics,omitempty"`
 }
 
 // Database holds data necessery for database configuration
 type Database struct {
-	PSN            string `yaml:"psn,omitempty"`
-	LogQueries     bool   `yaml:"log_queries,omitempty"`
-	TimeoutSeconds int    `yaml:"timeout_seconds,omitempty"`
+	PSN                     string   `yaml:"psn,omitempty"`
+	Replicas                []string `yaml:"replicas,omitempty"`
+	ReplicaCheckSeconds     int      `yaml:"replica_check_seconds,omitempty"`
+	LogQueries              bool     `yaml:"log_queries,omitempty"`
+	SlowQueryThresholdMs    int      `yaml:"slow_query_threshold_ms,omitempty"`
+	TimeoutSeconds          int      `yaml:"timeout_seconds,omitempty"`
+	SoftDeleteRetentionDays int      `yaml:"soft_delete_retention_days,omitempty"`
+	PurgeIntervalHours      int      `yaml:"purge_interval_hours,omitempty"`
+	PoolSize                int      `yaml:"pool_size,omitempty"`
+	MinIdleConns            int      `yaml:"min_idle_conns,omitempty"`
+	IdleTimeoutSeconds      int      `yaml:"idle_timeout_seconds,omitempty"`
+	MaxConnAgeSeconds       int      `yaml:"max_conn_age_seconds,omitempty"`
+	PoolTimeoutSeconds      int      `yaml:"pool_timeout_seconds,omitempty"`
+	StatementTimeoutSeconds int      `yaml:"statement_timeout_seconds,omitempty"`
 }
 
 // Server holds data necessery for server configuration
@@ -43,6 +62,12 @@ type Server struct {
 	Port                string `yaml:"port,omitempty"`
 	ReadTimeoutSeconds  int    `yaml:"read_timeout_seconds,omitempty"`
 	WriteTimeoutSeconds int    `yaml:"write_timeout_seconds,omitempty"`
+	TLSCertFile         string `yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile          string `yaml:"tls_key_file,omitempty"`
+	HTTPRedirectPort    string `yaml:"http_redirect_port,omitempty"`
+
+	// TrustedProxies are addresses or CIDR ranges of proxies whose X-Forwarded-For and X-Real-IP headers are honoured
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
 }
 
 // JWT holds data necessery for JWT configuration
@@ -62,3 +87,97 @@ type OpenAPI struct {
 	Username string `yaml:"username,omitempty"`
 	Password string `yaml:"password,omitempty"`
 }
+
+// Metrics holds username password for scraping metrics
+type Metrics struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// Redis holds data necessery for redis configuration
+type Redis struct {
+	Address  string `yaml:"address,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Port     int    `yaml:"port,omitempty"`
+}
+
+// Session holds data necessery for session store configuration
+type Session struct {
+	// Store is one of redis, postgres or memory
+	Store            string `yaml:"store,omitempty"`
+	Secret           string `yaml:"secret,omitempty"`
+	MigrateLegacy    bool   `yaml:"migrate_legacy,omitempty"`
+	Duration         int    `yaml:"duration_hours,omitempty"`
+	IdleTimeout      int    `yaml:"idle_timeout_minutes,omitempty"`
+	AdminIdleTimeout int    `yaml:"admin_idle_timeout_minutes,omitempty"`
+	CleanupInterval  int    `yaml:"cleanup_interval_seconds,omitempty"`
+	TouchInterval    int    `yaml:"touch_interval_seconds,omitempty"`
+}
+
+// Log holds logging configuration
+type Log struct {
+	Level      string `yaml:"level,omitempty"`
+	Format     string `yaml:"format,omitempty"`
+	SampleInfo uint32 `yaml:"sample_info,omitempty"`
+	File       string `yaml:"file,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+	Redact     Redact `yaml:"redact,omitempty"`
+}
+
+// Redact holds configuration of personal data redaction from logs
+type Redact struct {
+	Fields   []string `yaml:"fields,omitempty"`
+	Patterns []string `yaml:"patterns,omitempty"`
+	HashKey  string   `yaml:"hash_key,omitempty"`
+}
+
+// RateLimit holds rate limiting configuration
+type RateLimit struct {
+	// Store is either redis or memory
+	Store           string          `yaml:"store,omitempty"`
+	CleanupInterval int             `yaml:"cleanup_interval_seconds,omitempty"`
+	Rules           []RateLimitRule `yaml:"rules,omitempty"`
+}
+
+// RateLimitRule holds limit applied to requests matching method and path
+type RateLimitRule struct {
+	Name      string `yaml:"name,omitempty"`
+	Method    string `yaml:"method,omitempty"`
+	Path      string `yaml:"path,omitempty"`
+	Key       string `yaml:"key,omitempty"`
+	Algorithm string `yaml:"algorithm,omitempty"`
+	Requests  int    `yaml:"requests,omitempty"`
+	Window    int    `yaml:"window_seconds,omitempty"`
+	Burst     int    `yaml:"burst,omitempty"`
+}
+
+// CORS holds cross-origin resource sharing configuration
+type CORS struct {
+	AllowedOrigins   []string `yaml:"allowed_origins,omitempty"`
+	AllowedMethods   []string `yaml:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `yaml:"allowed_headers,omitempty"`
+	ExposedHeaders   []string `yaml:"exposed_headers,omitempty"`
+	AllowCredentials bool     `yaml:"allow_credentials,omitempty"`
+	MaxAge           int      `yaml:"max_age_seconds,omitempty"`
+}
+
+// Security holds security headers configuration
+type Security struct {
+	HSTSMaxAge            int    `yaml:"hsts_max_age_seconds,omitempty"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains,omitempty"`
+	HSTSPreload           bool   `yaml:"hsts_preload,omitempty"`
+	FrameOptions          string `yaml:"frame_options,omitempty"`
+	ContentSecurityPolicy string `yaml:"content_security_policy,omitempty"`
+	ReferrerPolicy        string `yaml:"referrer_policy,omitempty"`
+	TrustForwardedProto   bool   `yaml:"trust_forwarded_proto,omitempty"`
+}
+
+// Trace holds distributed tracing configuration
+type Trace struct {
+	// Exporter is one of otlp or stdout, tracing only propagates trace context if empty
+	Exporter    string  `yaml:"exporter,omitempty"`
+	Endpoint    string  `yaml:"endpoint,omitempty"`
+	ServiceName string  `yaml:"service_name,omitempty"`
+	SampleRatio float64 `yaml:"sample_ratio,omitempty"`
+}
@@ -32,11 +32,26 @@ func TestLoad(t *testing.T) {
 					Port:                ":8080",
 					ReadTimeoutSeconds:  31,
 					WriteTimeoutSeconds: 30,
+					TLSCertFile:         "/etc/chisk/tls.crt",
+					TLSKeyFile:          "/etc/chisk/tls.key",
+					HTTPRedirectPort:    ":80",
+					TrustedProxies:      []string{"10.0.0.0/8", "192.168.1.1"},
 				},
 				DB: config.Database{
-					PSN:            "postgre",
-					LogQueries:     true,
-					TimeoutSeconds: 10,
+					PSN:                     "postgre",
+					Replicas:                []string{"replica1", "replica2"},
+					ReplicaCheckSeconds:     10,
+					LogQueries:              true,
+					SlowQueryThresholdMs:    200,
+					TimeoutSeconds:          10,
+					SoftDeleteRetentionDays: 30,
+					PurgeIntervalHours:      24,
+					PoolSize:                20,
+					MinIdleConns:            2,
+					IdleTimeoutSeconds:      300,
+					MaxConnAgeSeconds:       1800,
+					PoolTimeoutSeconds:      5,
+					StatementTimeoutSeconds: 30,
 				},
 				JWT: config.JWT{
 					Secret:    "changedvalue",
@@ -50,6 +65,68 @@ func TestLoad(t *testing.T) {
 					Username: "twisk",
 					Password: "twisk",
 				},
+				Redis: config.Redis{
+					Address:  "localhost",
+					Password: "secret",
+					Port:     6379,
+				},
+				Session: config.Session{
+					Store:            "memory",
+					Secret:           "sessionsecret",
+					MigrateLegacy:    true,
+					Duration:         24,
+					IdleTimeout:      120,
+					AdminIdleTimeout: 30,
+					CleanupInterval:  60,
+					TouchInterval:    60,
+				},
+				Log: config.Log{
+					Level:      "debug",
+					Format:     "console",
+					SampleInfo: 10,
+					File:       "/var/log/chisk.log",
+					MaxSizeMB:  100,
+					MaxBackups: 5,
+					Redact: config.Redact{
+						Fields:   []string{"email", "password", "authorization"},
+						Patterns: []string{`\d{3}-\d{2}-\d{4}`},
+						HashKey:  "loghashkey",
+					},
+				},
+				RateLimit: config.RateLimit{
+					Store:           "redis",
+					CleanupInterval: 60,
+					Rules: []config.RateLimitRule{
+						{Name: "register", Method: "POST", Path: "/v1/users", Key: "ip", Algorithm: "sliding_window", Requests: 5, Window: 60},
+						{Name: "api", Path: "/v1/*", Key: "user", Algorithm: "token_bucket", Requests: 100, Window: 60, Burst: 20},
+					},
+				},
+				CORS: config.CORS{
+					AllowedOrigins:   []string{"https://app.chisk.io", "https://*.chisk.io"},
+					AllowedMethods:   []string{"GET", "POST", "DELETE"},
+					AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID"},
+					ExposedHeaders:   []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+					AllowCredentials: true,
+					MaxAge:           600,
+				},
+				Security: config.Security{
+					HSTSMaxAge:            31536000,
+					HSTSIncludeSubdomains: true,
+					FrameOptions:          "SAMEORIGIN",
+					ContentSecurityPolicy: "default-src 'self'",
+					ReferrerPolicy:        "strict-origin-when-cross-origin",
+					TrustForwardedProto:   true,
+				},
+				Trace: config.Trace{
+					Exporter:    "otlp",
+					Endpoint:    "http://localhost:4318",
+					ServiceName: "chisk",
+					SampleRatio: 0.25,
+				},
+				Metrics: config.Metrics{
+					Username: "prometheus",
+					Password: "scrape",
+				},
 			},
 			wantErr: false,
 		},
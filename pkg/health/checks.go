@@ -0,0 +1,23 @@
+package health
+
+import (
+	"context"
+
+	"github.com/go-pg/pg"
+	"github.com/go-redis/redis"
+)
+
+// DB checks database connection, the same way pgsql.New does
+func DB(db *pg.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		_, err := db.WithContext(ctx).Exec("SELECT 1")
+		return err
+	})
+}
+
+// Redis checks Redis connection
+func Redis(c *redis.Client) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return c.WithContext(ctx).Ping().Err()
+	})
+}
@@ -0,0 +1,162 @@
+// Package health provides liveness and readiness endpoints for orchestrators such as Kubernetes.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is used for checks added without timeout
+const DefaultTimeout = 2 * time.Second
+
+// Check statuses
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Checker checks whether a dependency is available
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts ordinary function to Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
+}
+
+// New creates health service without checks, logging failed checks to log
+func New(log Logger) *Health {
+	return &Health{log: log}
+}
+
+// Health reports service health
+type Health struct {
+	checks []check
+	log    Logger
+}
+
+type check struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+}
+
+// Add adds readiness check, failing if it does not complete within timeout.
+// Zero timeout defaults to DefaultTimeout.
+func (h *Health) Add(name string, c Checker, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	h.checks = append(h.checks, check{name: name, checker: c, timeout: timeout})
+}
+
+// Response is health endpoints' response body
+type Response struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks,omitempty"`
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+
+	// Err is the reason check failed. It is logged but never exposed to clients,
+	// as errors may reveal addresses of dependencies.
+	Err error `json:"-"`
+}
+
+// Live reports that the process is running. It checks no dependencies, as their outage
+// should not get the service restarted.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	write(w, http.StatusOK, Response{Status: StatusOK})
+}
+
+// Ready runs all checks concurrently, reporting service unavailable if any of them fails
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	res := h.Run(r.Context())
+	status := http.StatusOK
+	if res.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	for _, c := range res.Checks {
+		if c.Err != nil && h.log != nil {
+			h.log.Log(r.Context(), "health", "Readiness check failed", c.Err, map[string]interface{}{
+				"check":       c.Name,
+				"duration_ms": c.DurationMs,
+			})
+		}
+	}
+	write(w, status, res)
+}
+
+// Run runs all checks concurrently
+func (h *Health) Run(ctx context.Context) Response {
+	res := Response{Status: StatusOK, Checks: make([]Result, len(h.checks))}
+
+	var wg sync.WaitGroup
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			res.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, c := range res.Checks {
+		if c.Status != StatusOK {
+			res.Status = StatusUnavailable
+		}
+	}
+	return res
+}
+
+// run runs the check, giving up on it after timeout even if it ignores context
+func (c check) run(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.checker.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := Result{
+		Name:       c.name,
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		res.Status = StatusUnavailable
+		res.Err = err
+	}
+	return res
+}
+
+func write(w http.ResponseWriter, status int, res Response) {
+	w.Header().Set("Content-Type", "application/json")
+	// Probes must always see current state
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
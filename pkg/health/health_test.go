@@ -0,0 +1,126 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/health"
+)
+
+var (
+	ok = health.CheckerFunc(func(context.Context) error { return nil })
+
+	down = health.CheckerFunc(func(context.Context) error { return errors.New("connection refused") })
+
+	// hanging ignores context, as some clients do
+	hanging = health.CheckerFunc(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+)
+
+// logger records logged errors by check name
+type logger struct {
+	errs map[string]error
+}
+
+func (l *logger) Log(_ context.Context, source, msg string, err error, params map[string]interface{}) {
+	l.errs[params["check"].(string)] = err
+}
+
+func TestLive(t *testing.T) {
+	h := health.New(nil)
+	h.Add("db", down, 0)
+
+	rec := httptest.NewRecorder()
+	h.Live(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	type check struct {
+		name    string
+		checker health.Checker
+	}
+	cases := []struct {
+		name       string
+		checks     []check
+		wantStatus int
+		wantResp   health.Response
+		wantLogged map[string]error
+	}{
+		{
+			name:       "No checks",
+			wantStatus: http.StatusOK,
+			wantResp:   health.Response{Status: health.StatusOK},
+		},
+		{
+			name:       "All checks pass",
+			checks:     []check{{"db", ok}, {"redis", ok}},
+			wantStatus: http.StatusOK,
+			wantResp: health.Response{Status: health.StatusOK, Checks: []health.Result{
+				{Name: "db", Status: health.StatusOK},
+				{Name: "redis", Status: health.StatusOK},
+			}},
+		},
+		{
+			name:       "Check fails",
+			checks:     []check{{"db", down}, {"redis", ok}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantResp: health.Response{Status: health.StatusUnavailable, Checks: []health.Result{
+				{Name: "db", Status: health.StatusUnavailable},
+				{Name: "redis", Status: health.StatusOK},
+			}},
+			wantLogged: map[string]error{"db": errors.New("connection refused")},
+		},
+		{
+			name:       "Check times out",
+			checks:     []check{{"db", ok}, {"redis", hanging}},
+			wantStatus: http.StatusServiceUnavailable,
+			wantResp: health.Response{Status: health.StatusUnavailable, Checks: []health.Result{
+				{Name: "db", Status: health.StatusOK},
+				{Name: "redis", Status: health.StatusUnavailable},
+			}},
+			wantLogged: map[string]error{"redis": context.DeadlineExceeded},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &logger{errs: make(map[string]error)}
+			h := health.New(log)
+			for _, c := range tt.checks {
+				h.Add(c.name, c.checker, 50*time.Millisecond)
+			}
+
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			h.Ready(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+			assert.True(t, time.Since(start) < 500*time.Millisecond, "checks are bounded by their timeout")
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.NotContains(t, rec.Body.String(), "connection refused", "errors are not exposed")
+
+			var resp health.Response
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			for i := range resp.Checks {
+				resp.Checks[i].DurationMs = 0
+			}
+			assert.Equal(t, tt.wantResp, resp)
+
+			if tt.wantLogged == nil {
+				tt.wantLogged = map[string]error{}
+			}
+			assert.Equal(t, tt.wantLogged, log.errs)
+		})
+	}
+}
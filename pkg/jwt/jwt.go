@@ -2,13 +2,14 @@ package jwt
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/middleware/clientip"
 
 	jwt "github.com/dgrijalva/jwt-go"
 )
@@ -33,8 +34,8 @@ var (
 	errorParsingToken = errors.New("error parsing JWT token")
 )
 
-// New instantiates new JWT service
-func New(key string, duration int, algo string, sess SessionStorer) *JWT {
+// New instantiates new JWT service. Failures to record session activity are logged to log, if set.
+func New(key string, duration int, algo string, sess SessionStorer, log Logger) *JWT {
 	signingMethod := jwt.GetSigningMethod(algo)
 	if signingMethod == nil {
 		panic("invalid signing method")
@@ -44,6 +45,7 @@ func New(key string, duration int, algo string, sess SessionStorer) *JWT {
 		duration: time.Duration(duration) * time.Minute,
 		algo:     signingMethod,
 		sess:     sess,
+		log:      log,
 	}
 }
 
@@ -60,11 +62,34 @@ type JWT struct {
 
 	// Session storer interface
 	sess SessionStorer
+
+	log Logger
+
+	// Counts token validations, if set
+	validations Counter
+}
+
+// Counter counts events partitioned by label values
+type Counter interface {
+	Inc(labelValues ...string)
+}
+
+// CountValidations counts bearer token validations done by MWFunc on every authenticated request,
+// labeled with success or the error code returned to the client. They are not logins.
+func (j *JWT) CountValidations(c Counter) {
+	j.validations = c
 }
 
 // SessionStorer represents session store interface
 type SessionStorer interface {
-	Get(string) (*chisk.AuthUser, error)
+	// GetAndTouch returns user of the session belonging to token, recording activity on it.
+	// If only recording the activity fails, the user is returned along with the error.
+	GetAndTouch(ctx context.Context, token, ip, userAgent string) (*chisk.AuthUser, error)
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
 }
 
 // GenerateToken generates new jwt token
@@ -92,47 +117,45 @@ func (j *JWT) ParseToken(token string) error {
 	return nil
 }
 
-type errMsg struct {
-	Message string `json:"message"`
-}
-
 // MWFunc is a middleware func for JWT Authorization
 func (j *JWT) MWFunc(next http.Handler) http.Handler {
 	var (
-		missingAuthorizationHeader, _ = json.Marshal(errMsg{Message: "Missing Authorization header"})
-		missingBearerKeyword, _       = json.Marshal(errMsg{Message: "Missing Bearer keyword"})
-		cannotParseToken, _           = json.Marshal(errMsg{Message: errorParsingToken.Error()})
-		cannotRetreiveSession, _      = json.Marshal(errMsg{Message: "Error retreiving session"})
+		missingAuthorizationHeader = apperr.New(http.StatusUnauthorized, "missing_authorization", "Missing Authorization header")
+		missingBearerKeyword       = apperr.New(http.StatusUnauthorized, "missing_bearer", "Missing Bearer keyword")
+		cannotParseToken           = apperr.New(http.StatusUnauthorized, "invalid_token", errorParsingToken.Error())
+		cannotRetreiveSession      = apperr.New(http.StatusUnauthorized, "invalid_session", "Error retreiving session")
 	)
 
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		ah := r.Header.Get("Authorization")
 		if ah == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write(missingAuthorizationHeader)
+			j.fail(w, r, missingAuthorizationHeader)
 			return
 		}
 
 		spl := strings.Split(ah, " ")
-		if spl[0] != "Bearer" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write(missingBearerKeyword)
+		if len(spl) != 2 || spl[0] != "Bearer" {
+			j.fail(w, r, missingBearerKeyword)
 			return
 		}
 
 		token := spl[1]
 		if err := j.ParseToken(token); err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write(cannotParseToken)
+			j.fail(w, r, cannotParseToken)
 			return
 		}
 
-		user, err := j.sess.Get(token)
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write(cannotRetreiveSession)
+		user, err := j.sess.GetAndTouch(r.Context(), token, clientip.FromRequest(r), r.UserAgent())
+		if user == nil {
+			j.fail(w, r, cannotRetreiveSession)
 			return
 		}
+		if err != nil && j.log != nil {
+			// Last-seen tracking is best effort and must not fail the request
+			j.log.Log(r.Context(), "jwt", "Error recording session activity", err, nil)
+		}
+
+		j.count("success")
 
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, TokenKey, token)
@@ -140,8 +163,21 @@ func (j *JWT) MWFunc(next http.Handler) http.Handler {
 		ctx = context.WithValue(ctx, UserDisplayNameKey, user.DisplayName)
 		ctx = context.WithValue(ctx, UserRoleKey, user.Role)
 		ctx = context.WithValue(ctx, UserEmailKey, user.Email)
+		ctx = context.WithValue(ctx, chisk.KeyString("_authuser"), user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return http.HandlerFunc(fn)
 }
+
+// fail counts failed token validation and responds with err
+func (j *JWT) fail(w http.ResponseWriter, r *http.Request, err *apperr.Error) {
+	j.count(err.Code)
+	apperr.Write(w, r, err)
+}
+
+func (j *JWT) count(result string) {
+	if j.validations != nil {
+		j.validations.Inc(result)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-redis/redis"
+)
+
+// operations are SQL statements queries are labeled with, others being labeled as other
+var operations = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+	"BEGIN": true, "COMMIT": true, "ROLLBACK": true, "SAVEPOINT": true, "RELEASE": true,
+}
+
+// NewDB registers database query metrics
+func NewDB(r *Registry) *DB {
+	return &DB{
+		queries: r.Histogram("db_query_duration_seconds", "Database query latency in seconds.", nil, "db", "operation", "status"),
+	}
+}
+
+// DB instruments database queries
+type DB struct {
+	queries *Histogram
+}
+
+// Hook returns go-pg query hook measuring query latency, labeled with db name, e.g. primary or replica
+func (m *DB) Hook(db string) func(*pg.QueryProcessedEvent) {
+	return func(ev *pg.QueryProcessedEvent) {
+		op := "other"
+		if q, err := ev.UnformattedQuery(); err == nil {
+			if f := strings.Fields(q); len(f) > 0 && operations[strings.ToUpper(f[0])] {
+				op = strings.ToUpper(f[0])
+			}
+		}
+		m.queries.Observe(time.Since(ev.StartTime).Seconds(), db, op, status(ev.Error))
+	}
+}
+
+// NewRedis registers Redis command metrics
+func NewRedis(r *Registry) *Redis {
+	return &Redis{
+		commands: r.Histogram("redis_command_duration_seconds", "Redis command latency in seconds.", nil, "command", "status"),
+	}
+}
+
+// Redis instruments Redis commands
+type Redis struct {
+	commands *Histogram
+}
+
+// Instrument measures latency of commands processed by c
+func (m *Redis) Instrument(c *redis.Client) {
+	c.WrapProcess(func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			s := status(err)
+			if err == redis.Nil {
+				// Missing keys are regular results
+				s = "ok"
+			}
+			m.commands.Observe(time.Since(start).Seconds(), cmd.Name(), s)
+			return err
+		}
+	})
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ribice/chisk/pkg/middleware/wrap"
+)
+
+// NewHTTP registers HTTP request metrics
+func NewHTTP(r *Registry) *HTTP {
+	return &HTTP{
+		requests: r.Counter("http_requests_total", "Number of processed HTTP requests.", "method", "route", "status"),
+		duration: r.Histogram("http_request_duration_seconds", "HTTP request latency in seconds.", nil, "method", "route"),
+	}
+}
+
+// HTTP instruments HTTP requests
+type HTTP struct {
+	requests *Counter
+	duration *Histogram
+}
+
+// Middleware counts requests and measures their latency by method, chi route pattern and status.
+// Requests matching no route are labeled unmatched, keeping the number of series bounded.
+func (m *HTTP) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := wrap.New(w)
+		next.ServeHTTP(rw, r)
+
+		route := "unmatched"
+		if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		m.requests.Inc(r.Method, route, strconv.Itoa(rw.Status()))
+		m.duration.Observe(time.Since(start).Seconds(), r.Method, route)
+	}
+	return http.HandlerFunc(fn)
+}
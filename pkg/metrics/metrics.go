@@ -0,0 +1,315 @@
+// Package metrics collects counters, gauges and histograms, exposing them in Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suited for request and query durations in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var nameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// NewRegistry creates empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Registry holds metrics exposed together
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// register adds metric, panicking on invalid or duplicate names as those are programming errors
+func (r *Registry) register(d desc, m metric) {
+	if !nameRe.MatchString(d.name) {
+		panic(fmt.Sprintf("invalid metric name %q", d.name))
+	}
+	for _, l := range d.labels {
+		if !nameRe.MatchString(l) || strings.HasPrefix(l, "__") {
+			panic(fmt.Sprintf("invalid label name %q of metric %s", l, d.name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[d.name] {
+		panic(fmt.Sprintf("metric %s is already registered", d.name))
+	}
+	r.names[d.name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Counter creates counter partitioned by labels
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(desc{name: name, help: help, typ: "counter", labels: labels})}
+	r.register(c.desc, c)
+	return c
+}
+
+// Gauge creates gauge partitioned by labels
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(desc{name: name, help: help, typ: "gauge", labels: labels})}
+	r.register(g.desc, g)
+	return g
+}
+
+// GaugeFunc creates gauge whose value is read from fn when metrics are collected
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	g := &valueFunc{desc: desc{name: name, help: help, typ: "gauge"}, fn: fn}
+	r.register(g.desc, g)
+}
+
+// CounterFunc creates counter whose value is read from fn when metrics are collected,
+// e.g. from statistics kept by a client library. fn must never return a smaller value.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	c := &valueFunc{desc: desc{name: name, help: help, typ: "counter"}, fn: fn}
+	r.register(c.desc, c)
+}
+
+// Histogram creates histogram partitioned by labels, with DefaultBuckets if buckets are empty
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{vec: newVec(desc{name: name, help: help, typ: "histogram", labels: labels}), buckets: buckets}
+	r.register(h.desc, h)
+	return h
+}
+
+// Handler serves metrics in Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Write writes metrics in Prometheus text format, in order of registration
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// desc describes metric
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.typ)
+}
+
+// vec holds metric's series, one per combination of label values
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+
+	// Histogram state
+	counts []uint64
+	count  uint64
+}
+
+func newVec(d desc) vec {
+	return vec{desc: d, series: make(map[string]*series)}
+}
+
+// get returns series for label values, creating it if needed. It has to be called with mu held.
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns series ordered by label values, for stable output. It has to be called with mu held.
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := make([]*series, len(keys))
+	for i, k := range keys {
+		s[i] = v.series[k]
+	}
+	return s
+}
+
+// labelString formats label pairs, with extra pair appended if given
+func (v *vec) labelString(values []string, extra ...string) string {
+	names, vals := v.labels, values
+	if len(extra) == 2 {
+		names = append(append([]string(nil), names...), extra[0])
+		vals = append(append([]string(nil), vals...), extra[1])
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = n + `="` + esc.Replace(vals[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	vec
+}
+
+// Inc increments counter for label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments counter for label values by v, which must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.name))
+	}
+	c.mu.Lock()
+	c.get(labelValues).value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.writeHeader(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	vec
+}
+
+// Set sets gauge for label values to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value = v
+	g.mu.Unlock()
+}
+
+// Add adds v, which may be negative, to gauge for label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value += v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.writeHeader(w)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+// valueFunc is a gauge or counter without labels, read from fn
+type valueFunc struct {
+	desc
+	fn func() float64
+}
+
+func (g *valueFunc) write(w io.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+// Histogram counts observations, e.g. durations, in cumulative buckets
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// Observe adds observation v for label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	s := h.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.value += v
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.writeHeader(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", formatFloat(b)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labels), s.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
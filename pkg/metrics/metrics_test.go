@@ -0,0 +1,148 @@
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("sessions_total", "Number of session events.", "event")
+	g := r.Gauge("queue_size", "Number of queued jobs.")
+	r.GaugeFunc("pool_size", "Maximum number of connections.", func() float64 { return 20 })
+	h := r.Histogram("job_duration_seconds", "Job duration\nin seconds.", []float64{1, 0.1}, "job")
+
+	c.Inc("created")
+	c.Add(2, "created")
+	c.Inc(`re"voked`)
+	g.Set(5)
+	g.Add(-2)
+	h.Observe(0.05, "purge")
+	h.Observe(0.5, "purge")
+	h.Observe(5, "purge")
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Write(&buf))
+
+	want := `# HELP sessions_total Number of session events.
+# TYPE sessions_total counter
+sessions_total{event="created"} 3
+sessions_total{event="re\"voked"} 1
+# HELP queue_size Number of queued jobs.
+# TYPE queue_size gauge
+queue_size 3
+# HELP pool_size Maximum number of connections.
+# TYPE pool_size gauge
+pool_size 20
+# HELP job_duration_seconds Job duration\nin seconds.
+# TYPE job_duration_seconds histogram
+job_duration_seconds_bucket{job="purge",le="0.1"} 1
+job_duration_seconds_bucket{job="purge",le="1"} 2
+job_duration_seconds_bucket{job="purge",le="+Inf"} 3
+job_duration_seconds_sum{job="purge"} 5.55
+job_duration_seconds_count{job="purge"} 3
+`
+	assert.Equal(t, want, buf.String())
+}
+
+// sampleRe matches sample lines of Prometheus text format: metric name, optional label pairs
+// with escaped values and a float value
+var sampleRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*` +
+	`(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*")*\})?` +
+	` (?:[+-]?Inf|NaN|[-+]?[0-9.]+(?:e[-+]?[0-9]+)?)$`)
+
+func TestExposition(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("errors_total", `Errors by path, e.g. C:\tmp.`, "path")
+	r.CounterFunc("pool_timeouts_total", "Pool timeouts.", func() float64 { return 7 })
+	r.Gauge("idle", "Gauge without series.")
+	g := r.Gauge("temperature", "Special values.", "kind")
+	h := r.Histogram("size_bytes", "Sizes.", []float64{100, 10}, "kind", "route")
+
+	c.Inc("C:\\tmp\n\"quoted\"")
+	g.Set(math.Inf(1), "max")
+	g.Set(math.Inf(-1), "min")
+	g.Set(math.NaN(), "unknown")
+	g.Set(1e21, "large")
+	h.Observe(10, "a", "/")
+	h.Observe(1000, "a", "/")
+	h.Observe(5000, "a", "/")
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Write(&buf))
+
+	want := `# HELP errors_total Errors by path, e.g. C:\\tmp.
+# TYPE errors_total counter
+errors_total{path="C:\\tmp\n\"quoted\""} 1
+# HELP pool_timeouts_total Pool timeouts.
+# TYPE pool_timeouts_total counter
+pool_timeouts_total 7
+# HELP idle Gauge without series.
+# TYPE idle gauge
+# HELP temperature Special values.
+# TYPE temperature gauge
+temperature{kind="large"} 1e+21
+temperature{kind="max"} +Inf
+temperature{kind="min"} -Inf
+temperature{kind="unknown"} NaN
+# HELP size_bytes Sizes.
+# TYPE size_bytes histogram
+size_bytes_bucket{kind="a",route="/",le="10"} 1
+size_bytes_bucket{kind="a",route="/",le="100"} 1
+size_bytes_bucket{kind="a",route="/",le="+Inf"} 3
+size_bytes_sum{kind="a",route="/"} 6010
+size_bytes_count{kind="a",route="/"} 3
+`
+	assert.Equal(t, want, buf.String())
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if !strings.HasPrefix(line, "# ") {
+			assert.Regexp(t, sampleRe, line)
+		}
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("requests_total", "Requests.", "method")
+
+	assert.Panics(t, func() { r.Counter("requests_total", "Requests.") }, "duplicate name")
+	assert.Panics(t, func() { r.Counter("requests-total", "Requests.") }, "invalid name")
+	assert.Panics(t, func() { r.Counter("errors_total", "Errors.", "__reserved") }, "reserved label")
+	assert.Panics(t, func() { c.Inc() }, "missing label value")
+	assert.Panics(t, func() { c.Add(-1, "GET") }, "decreasing counter")
+}
+
+func TestHTTP(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := metrics.NewHTTP(reg)
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	r.Get("/metrics", reg.Handler().ServeHTTP)
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/users/{id}",status="204"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/users/{id}"} 2`)
+	assert.NotContains(t, body, "/users/1", "raw paths are not used as labels")
+}
@@ -0,0 +1,47 @@
+package basicauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/basicauth"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name       string
+		username   string
+		password   string
+		setAuth    bool
+		user       string
+		pass       string
+		wantStatus int
+	}{
+		{name: "Valid credentials", username: "docs", password: "secret", setAuth: true, user: "docs", pass: "secret", wantStatus: http.StatusOK},
+		{name: "Missing credentials", username: "docs", password: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "Wrong password", username: "docs", password: "secret", setAuth: true, user: "docs", pass: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "Wrong username", username: "docs", password: "secret", setAuth: true, user: "admin", pass: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "Credentials not configured", setAuth: true, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			h := basicauth.New(tt.username, tt.password, "API docs")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest("GET", "/docs/", nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="API docs", charset="UTF-8"`, w.Header().Get("WWW-Authenticate"))
+				assert.JSONEq(t, `{"code":"unauthorized","message":"Unauthorized"}`, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Package clientip resolves IP addresses of clients making requests, honouring X-Forwarded-For
+// and X-Real-IP headers only when they were set by trusted proxies.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// New creates middleware resolving client IPs behind proxies within trusted CIDR ranges,
+// e.g. 10.0.0.0/8. Single addresses are treated as /32 or /128 ranges.
+// Forwarding headers are ignored if no proxies are trusted.
+func New(trusted []string) (func(http.Handler) http.Handler, error) {
+	nets := make([]*net.IPNet, 0, len(trusted))
+	for _, t := range trusted {
+		if !strings.Contains(t, "/") {
+			ip := net.ParseIP(t)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", t)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", t, err)
+		}
+		nets = append(nets, n)
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ip := resolve(r, nets)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, ip)))
+		}
+		return http.HandlerFunc(fn)
+	}, nil
+}
+
+type ctxKey struct{}
+
+// FromRequest returns client IP resolved by middleware created with New,
+// or the address of the request's peer if the middleware did not run
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(ctxKey{}).(string); ok {
+		return ip
+	}
+	return peer(r)
+}
+
+// resolve returns the rightmost address in X-Forwarded-For that is not a trusted proxy,
+// as addresses left of it may be set by the client. X-Real-IP is used if X-Forwarded-For is not set.
+func resolve(r *http.Request, trusted []*net.IPNet) string {
+	ip := peer(r)
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				// Malformed hops are not trusted, so the last valid address is used
+				break
+			}
+			ip = hop
+			if !isTrusted(hop, trusted) {
+				break
+			}
+		}
+		return ip
+	}
+
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xri) != nil {
+		return xri
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// peer returns IP address of the request's peer, which is a proxy if there is one
+func peer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,116 @@
+package clientip_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/clientip"
+)
+
+func TestNew(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}
+
+	cases := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		header     map[string][]string
+		want       string
+	}{
+		{
+			name:       "Direct client",
+			trusted:    trusted,
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Forwarding headers from untrusted peer",
+			trusted:    trusted,
+			remoteAddr: "203.0.113.7:1234",
+			header:     map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "No trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "Forwarded by trusted proxy",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed hops left of the client are ignored",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 192.168.1.1", "10.0.0.2"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Only trusted hops",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "Malformed hop",
+			trusted:    trusted,
+			remoteAddr: "10.0.0.1:1234",
+			header:     map[string][]string{"X-Forwarded-For": {"garbage, 10.0.0.2"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Real IP from trusted proxy",
+			trusted:    trusted,
+			remoteAddr: "[fd00::1]:1234",
+			header:     map[string][]string{"X-Real-Ip": {"2001:db8::1"}},
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "Invalid real IP",
+			trusted:    trusted,
+			remoteAddr: "192.168.1.1:1234",
+			header:     map[string][]string{"X-Real-Ip": {"unknown"}},
+			want:       "192.168.1.1",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := clientip.New(tt.trusted)
+			assert.NoError(t, err)
+
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = clientip.FromRequest(r) })
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			mw(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, trusted := range []string{"10.0.0.0/33", "proxy.local"} {
+		_, err := clientip.New([]string{trusted})
+		assert.Error(t, err, trusted)
+	}
+}
+
+func TestFromRequestWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	assert.Equal(t, "10.0.0.1", clientip.FromRequest(req))
+}
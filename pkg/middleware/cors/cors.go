@@ -0,0 +1,207 @@
+// Package cors handles cross-origin resource sharing, allowing browser applications served from
+// other origins to call the API.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures allowed cross-origin requests
+type Options struct {
+	// AllowedOrigins are origins allowed to make requests, e.g. https://app.example.com.
+	// Wildcard subdomains are allowed as https://*.example.com, and * allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods defaults to GET, POST, PUT, PATCH, DELETE and HEAD
+	AllowedMethods []string
+
+	// AllowedHeaders are request headers clients may send, * allowing any
+	AllowedHeaders []string
+
+	// ExposedHeaders are response headers clients may read
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests carrying cookies or authorization from listed origins.
+	// Origins allowed only by * never get credentials, as any site could then act on behalf of users.
+	AllowCredentials bool
+
+	// MaxAge is how long preflight responses may be cached, not cached if zero
+	MaxAge time.Duration
+}
+
+// DefaultMethods are methods allowed if options leave them empty
+var DefaultMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+// New creates CORS middleware. Preflight requests from allowed origins are answered
+// without reaching next handlers.
+func New(o Options) func(http.Handler) http.Handler {
+	c := &cors{
+		origins:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		exposed:     strings.Join(o.ExposedHeaders, ", "),
+		credentials: o.AllowCredentials,
+	}
+	methods := o.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	for _, m := range methods {
+		c.methods = append(c.methods, strings.ToUpper(m))
+	}
+	for _, origin := range o.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			i := strings.Index(origin, "*")
+			c.wildcards = append(c.wildcards, wildcard{prefix: origin[:i], suffix: origin[i+1:]})
+		default:
+			c.origins[origin] = true
+		}
+	}
+	for _, h := range o.AllowedHeaders {
+		if h == "*" {
+			c.anyHeader = true
+		}
+		c.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	if o.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(o.MaxAge / time.Second))
+	}
+
+	return c.handler
+}
+
+type cors struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   []wildcard
+	methods     []string
+	anyHeader   bool
+	headers     map[string]bool
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// wildcard matches origins with any subdomain between prefix and suffix,
+// e.g. https:// and .example.com
+type wildcard struct {
+	prefix, suffix string
+}
+
+func (w wildcard) matches(origin string) bool {
+	return len(origin) > len(w.prefix)+len(w.suffix) &&
+		strings.HasPrefix(origin, w.prefix) &&
+		strings.HasSuffix(origin, w.suffix)
+}
+
+func (c *cors) handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		h := w.Header()
+		// Responses differ per origin, so caches must not share them
+		h.Add("Vary", "Origin")
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !c.allowedOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.listedOrigin(origin) {
+			h.Set("Access-Control-Allow-Origin", origin)
+			if c.credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+
+		if !preflight {
+			if c.exposed != "" {
+				h.Set("Access-Control-Expose-Headers", c.exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		headers := r.Header.Get("Access-Control-Request-Headers")
+		if !c.allowedMethod(method) || !c.allowedHeaders(headers) {
+			// Browsers fail the request without allow headers
+			h.Del("Access-Control-Allow-Origin")
+			h.Del("Access-Control-Allow-Credentials")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+		if headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if c.maxAge != "" {
+			h.Set("Access-Control-Max-Age", c.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (c *cors) allowedOrigin(origin string) bool {
+	return c.anyOrigin || c.listedOrigin(origin)
+}
+
+// listedOrigin reports whether origin is allowed explicitly or by wildcard subdomain, rather than by *
+func (c *cors) listedOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if c.origins[origin] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if w.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cors) allowedMethod(method string) bool {
+	// Simple methods are always allowed
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodPost {
+		return true
+	}
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedHeaders checks comma separated list of requested headers
+func (c *cors) allowedHeaders(headers string) bool {
+	if c.anyHeader || headers == "" {
+		return true
+	}
+	for _, h := range strings.Split(headers, ",") {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h != "" && !c.headers[h] {
+			return false
+		}
+	}
+	return true
+}
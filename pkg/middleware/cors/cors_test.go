@@ -0,0 +1,180 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/cors"
+)
+
+func TestNew(t *testing.T) {
+	opts := cors.Options{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.chisk.io"},
+		AllowedMethods:   []string{"get", "post", "delete"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	cases := []struct {
+		name        string
+		opts        cors.Options
+		method      string
+		header      map[string]string
+		wantStatus  int
+		wantNext    bool
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "No origin",
+			opts:        opts,
+			method:      "GET",
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "Allowed origin",
+			opts:       opts,
+			method:     "GET",
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:        "Wildcard subdomain",
+			opts:        opts,
+			method:      "GET",
+			header:      map[string]string{"Origin": "https://admin.chisk.io"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://admin.chisk.io"},
+		},
+		{
+			name:        "Wildcard does not match the domain itself",
+			opts:        opts,
+			method:      "GET",
+			header:      map[string]string{"Origin": "https://chisk.io"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "Disallowed origin",
+			opts:        opts,
+			method:      "GET",
+			header:      map[string]string{"Origin": "https://evil.com"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "Preflight",
+			opts:   opts,
+			method: "OPTIONS",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "DELETE",
+				"Access-Control-Request-Headers": "authorization, content-type",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+				"Access-Control-Allow-Headers":     "authorization, content-type",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Access-Control-Expose-Headers":    "",
+			},
+		},
+		{
+			name: "Preflight with disallowed method",
+			opts: opts,
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PUT",
+			},
+			method:      "OPTIONS",
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name: "Preflight with disallowed header",
+			opts: opts,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "X-Debug",
+			},
+			method:      "OPTIONS",
+			wantStatus:  http.StatusNoContent,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:        "Options without preflight headers",
+			opts:        opts,
+			method:      "OPTIONS",
+			header:      map[string]string{"Origin": "https://app.example.com"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com"},
+		},
+		{
+			name:        "Any origin",
+			opts:        cors.Options{AllowedOrigins: []string{"*"}},
+			method:      "GET",
+			header:      map[string]string{"Origin": "https://anything.com"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:        "Any origin with credentials does not allow credentials",
+			opts:        cors.Options{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			method:      "GET",
+			header:      map[string]string{"Origin": "https://anything.com"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name:        "Listed origin keeps credentials along with any origin",
+			opts:        cors.Options{AllowedOrigins: []string{"*", "https://app.example.com"}, AllowCredentials: true},
+			method:      "GET",
+			header:      map[string]string{"Origin": "https://app.example.com"},
+			wantStatus:  http.StatusOK,
+			wantNext:    true,
+			wantHeaders: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Allow-Credentials": "true"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+			req := httptest.NewRequest(tt.method, "/v1/users", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			cors.New(tt.opts)(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantNext, called)
+			for k, v := range tt.wantHeaders {
+				assert.Equal(t, v, rec.Header().Get(k), k)
+			}
+		})
+	}
+}
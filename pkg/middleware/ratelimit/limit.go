@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Algorithm is rate limiting algorithm
+type Algorithm string
+
+// Supported algorithms
+const (
+	// TokenBucket allows bursts of up to Burst requests, refilling Requests tokens per Window
+	TokenBucket Algorithm = "token_bucket"
+
+	// SlidingWindow allows Requests per Window, weighting previous window's count by its overlap
+	// with the sliding window
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// Limit describes allowed request rate
+type Limit struct {
+	Algorithm Algorithm
+	Requests  int
+	Window    time.Duration
+
+	// Burst is token bucket capacity, defaulting to Requests
+	Burst int
+}
+
+func (l Limit) capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate returns token bucket refill rate in tokens per nanosecond
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / float64(l.Window)
+}
+
+// ttl returns how long limiter state has to be kept
+func (l Limit) ttl() time.Duration {
+	if l.Algorithm == TokenBucket {
+		return time.Duration(float64(l.capacity())/l.rate()) + time.Second
+	}
+	return 2 * l.Window
+}
+
+// Result is the outcome of a rate limit check
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is time until quota is fully restored
+	Reset time.Duration
+
+	// RetryAfter is time until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// tokenBucketResult computes result from the number of tokens left after the check
+func tokenBucketResult(l Limit, allowed bool, tokens float64) Result {
+	capacity := l.capacity()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     capacity,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(capacity) - tokens) / l.rate()),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / l.rate())
+	}
+	return res
+}
+
+// slidingWindowResult computes result from previous and current window counts after the check,
+// elapsed being time since the current window started
+func slidingWindowResult(l Limit, allowed bool, prev, curr int, elapsed time.Duration) Result {
+	weight := 1 - float64(elapsed)/float64(l.Window)
+	count := float64(prev)*weight + float64(curr)
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.Requests,
+		Remaining: l.Requests - int(math.Ceil(count)),
+		Reset:     l.Window - elapsed,
+	}
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	if curr > 0 {
+		// Current window's requests are weighted in throughout the next one
+		res.Reset += l.Window
+	}
+
+	if allowed {
+		return res
+	}
+	res.RetryAfter = l.Window - elapsed
+	if prev > 0 && curr < l.Requests {
+		// Previous window's weight has to drop until another request fits
+		need := time.Duration(float64(l.Window) * (1 - float64(l.Requests-1-curr)/float64(prev)))
+		res.RetryAfter = need - elapsed
+	}
+	return res
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NewMemoryStore creates in-memory store, suitable for single instance deployments.
+// Stale entries are evicted every cleanup interval, if it is greater than zero.
+func NewMemoryStore(cleanup time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		entries: make(map[string]*memEntry),
+		now:     time.Now,
+		done:    make(chan struct{}),
+	}
+	if cleanup > 0 {
+		go m.evict(cleanup)
+	}
+	return m
+}
+
+// MemoryStore keeps limiter state in memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memEntry
+	now     func() time.Time
+	done    chan struct{}
+	once    sync.Once
+}
+
+type memEntry struct {
+	// Token bucket state
+	tokens float64
+	last   time.Time
+
+	// Sliding window state
+	window     int64
+	prev, curr int
+
+	expiresAt time.Time
+}
+
+// Allow checks whether request identified by key is within limit, counting it if so
+func (m *MemoryStore) Allow(_ context.Context, key string, l Limit) (Result, error) {
+	return m.check(key, l, true), nil
+}
+
+// Peek checks whether request identified by key would be within limit, without counting it
+func (m *MemoryStore) Peek(_ context.Context, key string, l Limit) (Result, error) {
+	return m.check(key, l, false), nil
+}
+
+func (m *MemoryStore) check(key string, l Limit, count bool) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	e, ok := m.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = &memEntry{tokens: float64(l.capacity()), last: now}
+		m.entries[key] = e
+	}
+	e.expiresAt = now.Add(l.ttl())
+
+	if l.Algorithm == TokenBucket {
+		e.tokens += float64(now.Sub(e.last)) * l.rate()
+		if capacity := float64(l.capacity()); e.tokens > capacity {
+			e.tokens = capacity
+		}
+		e.last = now
+
+		allowed := e.tokens >= 1
+		if allowed && count {
+			e.tokens--
+		}
+		return tokenBucketResult(l, allowed, e.tokens)
+	}
+
+	window := now.UnixNano() / int64(l.Window)
+	switch window - e.window {
+	case 0:
+	case 1:
+		e.prev, e.curr = e.curr, 0
+	default:
+		e.prev, e.curr = 0, 0
+	}
+	e.window = window
+
+	elapsed := time.Duration(now.UnixNano() - window*int64(l.Window))
+	allowed := slidingWindowResult(l, true, e.prev, e.curr, elapsed).Remaining > 0
+	if allowed && count {
+		e.curr++
+	}
+	return slidingWindowResult(l, allowed, e.prev, e.curr, elapsed)
+}
+
+// Close stops eviction of stale entries
+func (m *MemoryStore) Close() {
+	m.once.Do(func() { close(m.done) })
+}
+
+func (m *MemoryStore) evict(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			now := m.now()
+			m.mu.Lock()
+			for k, e := range m.entries {
+				if !now.Before(e.expiresAt) {
+					delete(m.entries, k)
+				}
+			}
+			m.mu.Unlock()
+		case <-m.done:
+			return
+		}
+	}
+}
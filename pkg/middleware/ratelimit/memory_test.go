@@ -0,0 +1,64 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/ratelimit"
+)
+
+func TestMemoryStore(t *testing.T) {
+	cases := []struct {
+		name  string
+		limit ratelimit.Limit
+		want  []ratelimit.Result
+	}{
+		{
+			name:  "Token bucket",
+			limit: ratelimit.Limit{Algorithm: ratelimit.TokenBucket, Requests: 1, Window: time.Hour, Burst: 2},
+			want: []ratelimit.Result{
+				{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Hour},
+				{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Hour},
+				{Allowed: false, Limit: 2, Remaining: 0, Reset: 2 * time.Hour, RetryAfter: time.Hour},
+			},
+		},
+		{
+			name:  "Sliding window",
+			limit: ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 2, Window: 24 * time.Hour},
+			want: []ratelimit.Result{
+				{Allowed: true, Limit: 2, Remaining: 1},
+				{Allowed: true, Limit: 2, Remaining: 0},
+				{Allowed: false, Limit: 2, Remaining: 0},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ratelimit.NewMemoryStore(0)
+			for i, want := range tt.want {
+				peeked, err := s.Peek(context.Background(), "ip:127.0.0.1", tt.limit)
+				assert.NoError(t, err)
+				assert.Equal(t, want.Allowed, peeked.Allowed, "peek %d does not count the request", i)
+
+				res, err := s.Allow(context.Background(), "ip:127.0.0.1", tt.limit)
+				assert.NoError(t, err)
+				assert.Equal(t, want.Allowed, res.Allowed, "request %d", i)
+				assert.Equal(t, want.Limit, res.Limit, "request %d", i)
+				assert.Equal(t, want.Remaining, res.Remaining, "request %d", i)
+				if tt.limit.Algorithm == ratelimit.TokenBucket {
+					assert.InDelta(t, want.Reset, res.Reset, float64(time.Second), "request %d", i)
+					assert.InDelta(t, want.RetryAfter, res.RetryAfter, float64(time.Second), "request %d", i)
+				} else if !res.Allowed {
+					assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= tt.limit.Window, "request %d", i)
+				}
+			}
+
+			res, err := s.Allow(context.Background(), "ip:10.0.0.1", tt.limit)
+			assert.NoError(t, err)
+			assert.True(t, res.Allowed, "other keys are counted separately")
+		})
+	}
+}
@@ -0,0 +1,261 @@
+// Package ratelimit throttles requests per client using token bucket or sliding window limits,
+// kept in memory or in Redis for deployments running multiple instances.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/middleware/clientip"
+)
+
+// APIKeyHeader is the header API keys are read from
+const APIKeyHeader = "X-API-Key"
+
+// ErrTooManyRequests is returned to clients exceeding their limit
+var ErrTooManyRequests = apperr.New(http.StatusTooManyRequests, "rate_limited", "Too many requests")
+
+// Store counts requests against limits
+type Store interface {
+	// Allow checks whether request identified by key is within limit, counting it if so
+	Allow(ctx context.Context, key string, l Limit) (Result, error)
+	// Peek checks whether request identified by key would be within limit, without counting it
+	Peek(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
+}
+
+// Key is what clients are identified by
+type Key string
+
+// Supported keys
+const (
+	// ByIP identifies clients by IP address
+	ByIP Key = "ip"
+
+	// ByUser identifies clients by authenticated user ID, falling back to IP address
+	ByUser Key = "user"
+
+	// ByAPIKey identifies clients by API key header, falling back to IP address
+	ByAPIKey Key = "api_key"
+)
+
+// Rule applies limit to requests matching method and path
+type Rule struct {
+	// Name separates counters of different rules
+	Name string
+
+	// Method matches any method if empty
+	Method string
+
+	// Path is route pattern, where {param} matches a single segment and trailing * matches the rest
+	Path string
+
+	Key Key
+	Limit
+}
+
+func (r Rule) matches(req *http.Request) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+	pattern := strings.Split(strings.Trim(r.Path, "/"), "/")
+	path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i, seg := range pattern {
+		if seg == "*" && i == len(pattern)-1 {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if !strings.HasPrefix(seg, "{") && seg != path[i] {
+			return false
+		}
+	}
+	return len(pattern) == len(path)
+}
+
+// New creates rate limiter. Requests are limited by the first rule they match.
+func New(store Store, log Logger, rules ...Rule) (*Limiter, error) {
+	for _, r := range rules {
+		if r.Name == "" || r.Path == "" {
+			return nil, fmt.Errorf("rate limit rule requires name and path")
+		}
+		if r.Requests <= 0 || r.Window <= 0 {
+			return nil, fmt.Errorf("rate limit rule %s requires positive requests and window", r.Name)
+		}
+		switch r.Algorithm {
+		case TokenBucket, SlidingWindow:
+		default:
+			return nil, fmt.Errorf("rate limit rule %s has unknown algorithm %q", r.Name, r.Algorithm)
+		}
+		switch r.Key {
+		case ByIP, ByUser, ByAPIKey:
+		default:
+			return nil, fmt.Errorf("rate limit rule %s has unknown key %q", r.Name, r.Key)
+		}
+	}
+	return &Limiter{store: store, log: log, rules: rules}, nil
+}
+
+// Limiter limits request rate
+type Limiter struct {
+	store Store
+	log   Logger
+	rules []Rule
+}
+
+type ctxKey struct{}
+
+// deferred is rule keyed by user, left to User middleware by Middleware
+type deferred struct {
+	rule    *Rule
+	checked bool
+}
+
+// Middleware limits requests matching rules. Rules keyed by user are checked by User
+// middleware once the request is authenticated, unless it carries no credentials.
+// Requests whose credentials are never resolved to a user, e.g. as they are invalid or
+// the route requires no authentication, are counted by IP instead.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		rule := l.match(r)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if rule.Key != ByUser || r.Header.Get("Authorization") == "" {
+			if l.allow(w, r, rule, key(rule.Key, r)) {
+				next.ServeHTTP(w, r)
+			}
+			return
+		}
+
+		// Clients whose unresolved requests used up the IP limit are rejected before authentication
+		ipKey := key(ByIP, r)
+		if !l.peek(w, r, rule, ipKey) {
+			return
+		}
+		d := &deferred{rule: rule}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, d)))
+		if !d.checked {
+			l.count(r, rule, ipKey)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// User checks rule keyed by user, deferred by Middleware. It has to run after authentication middleware.
+func (l *Limiter) User(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		d, ok := r.Context().Value(ctxKey{}).(*deferred)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		k := key(ByUser, r)
+		if !strings.HasPrefix(k, "user:") {
+			// No authenticated user, left to Middleware to count by IP
+			next.ServeHTTP(w, r)
+			return
+		}
+		d.checked = true
+		if l.allow(w, r, d.rule, k) {
+			next.ServeHTTP(w, r)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (l *Limiter) match(r *http.Request) *Rule {
+	for i := range l.rules {
+		if l.rules[i].matches(r) {
+			return &l.rules[i]
+		}
+	}
+	return nil
+}
+
+// allow counts request, setting RateLimit headers, and responds with 429 if it is over the limit.
+// Requests are allowed if the store fails, as throttling must not take the API down.
+func (l *Limiter) allow(w http.ResponseWriter, r *http.Request, rule *Rule, key string) bool {
+	res, err := l.store.Allow(r.Context(), rule.Name+":"+key, rule.Limit)
+	if err != nil {
+		l.log.Log(r.Context(), "ratelimit", "Error checking rate limit", err, map[string]interface{}{"rule": rule.Name})
+		return true
+	}
+
+	return respond(w, r, res)
+}
+
+// peek responds with 429 if request would be over the limit, without counting it
+func (l *Limiter) peek(w http.ResponseWriter, r *http.Request, rule *Rule, key string) bool {
+	res, err := l.store.Peek(r.Context(), rule.Name+":"+key, rule.Limit)
+	if err != nil {
+		l.log.Log(r.Context(), "ratelimit", "Error checking rate limit", err, map[string]interface{}{"rule": rule.Name})
+		return true
+	}
+	if res.Allowed {
+		return true
+	}
+	return respond(w, r, res)
+}
+
+// count counts request that has already been responded to
+func (l *Limiter) count(r *http.Request, rule *Rule, key string) {
+	if _, err := l.store.Allow(r.Context(), rule.Name+":"+key, rule.Limit); err != nil {
+		l.log.Log(r.Context(), "ratelimit", "Error checking rate limit", err, map[string]interface{}{"rule": rule.Name})
+	}
+}
+
+// respond sets RateLimit headers from res, and responds with 429 if request is not allowed
+func respond(w http.ResponseWriter, r *http.Request, res Result) bool {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", seconds(res.Reset))
+	if res.Allowed {
+		return true
+	}
+
+	h.Set("Retry-After", seconds(res.RetryAfter))
+	apperr.Write(w, r, ErrTooManyRequests)
+	return false
+}
+
+// key identifies the client making the request
+func key(k Key, r *http.Request) string {
+	switch k {
+	case ByUser:
+		if user, ok := r.Context().Value(chisk.KeyString("_authuser")).(*chisk.AuthUser); ok {
+			return "user:" + user.ID
+		}
+	case ByAPIKey:
+		if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+			// Keys are hashed, as they end up in the store
+			sum := sha256.Sum256([]byte(apiKey))
+			return "api_key:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	return "ip:" + clientip.FromRequest(r)
+}
+
+// seconds formats d as whole seconds, rounded up
+func seconds(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
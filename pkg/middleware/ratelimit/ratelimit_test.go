@@ -0,0 +1,223 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/middleware/clientip"
+	"github.com/ribice/chisk/pkg/middleware/ratelimit"
+)
+
+type logger struct {
+	errs []error
+}
+
+func (l *logger) Log(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
+	l.errs = append(l.errs, err)
+}
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func (failingStore) Peek(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+func TestNew(t *testing.T) {
+	limit := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 1, Window: time.Minute}
+	cases := []struct {
+		name    string
+		rule    ratelimit.Rule
+		wantErr bool
+	}{
+		{name: "Valid", rule: ratelimit.Rule{Name: "register", Path: "/v1/users", Key: ratelimit.ByIP, Limit: limit}},
+		{name: "Missing path", rule: ratelimit.Rule{Name: "register", Key: ratelimit.ByIP, Limit: limit}, wantErr: true},
+		{name: "Unknown key", rule: ratelimit.Rule{Name: "register", Path: "/", Key: "cookie", Limit: limit}, wantErr: true},
+		{
+			name:    "Unknown algorithm",
+			rule:    ratelimit.Rule{Name: "register", Path: "/", Key: ratelimit.ByIP, Limit: ratelimit.Limit{Algorithm: "leaky_bucket", Requests: 1, Window: time.Minute}},
+			wantErr: true,
+		},
+		{
+			name:    "Zero window",
+			rule:    ratelimit.Rule{Name: "register", Path: "/", Key: ratelimit.ByIP, Limit: ratelimit.Limit{Algorithm: ratelimit.TokenBucket, Requests: 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ratelimit.New(ratelimit.NewMemoryStore(0), &logger{}, tt.rule)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limit := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 1, Window: 24 * time.Hour}
+	l, err := ratelimit.New(ratelimit.NewMemoryStore(0), &logger{},
+		ratelimit.Rule{Name: "register", Method: "POST", Path: "/v1/users", Key: ratelimit.ByIP, Limit: limit},
+		ratelimit.Rule{Name: "sessions", Path: "/v1/users/{id}/sessions", Key: ratelimit.ByAPIKey, Limit: limit},
+	)
+	assert.NoError(t, err)
+	h := l.Middleware(ok)
+
+	cases := []struct {
+		name       string
+		method     string
+		path       string
+		remoteAddr string
+		apiKey     string
+		wantStatus int
+		wantLimit  string
+	}{
+		{name: "Unmatched method", method: "GET", path: "/v1/users", wantStatus: http.StatusOK},
+		{name: "Unmatched path", method: "POST", path: "/v1/users/1", wantStatus: http.StatusOK},
+		{name: "First registration", method: "POST", path: "/v1/users", wantStatus: http.StatusOK, wantLimit: "1"},
+		{name: "Second registration", method: "POST", path: "/v1/users/", wantStatus: http.StatusTooManyRequests, wantLimit: "1"},
+		{name: "Registration from another IP", method: "POST", path: "/v1/users", remoteAddr: "10.0.0.1:1234", wantStatus: http.StatusOK, wantLimit: "1"},
+		{name: "Path param", method: "DELETE", path: "/v1/users/1/sessions", apiKey: "key1", wantStatus: http.StatusOK, wantLimit: "1"},
+		{name: "Same API key", method: "DELETE", path: "/v1/users/2/sessions", apiKey: "key1", wantStatus: http.StatusTooManyRequests, wantLimit: "1"},
+		{name: "Another API key", method: "DELETE", path: "/v1/users/1/sessions", apiKey: "key2", wantStatus: http.StatusOK, wantLimit: "1"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(ratelimit.APIKeyHeader, tt.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLimit, rec.Header().Get("RateLimit-Limit"))
+			if tt.wantStatus == http.StatusTooManyRequests {
+				assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+				assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+				assert.Contains(t, rec.Body.String(), "rate_limited")
+			}
+		})
+	}
+}
+
+func TestBehindProxy(t *testing.T) {
+	limit := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 1, Window: time.Hour}
+	l, err := ratelimit.New(ratelimit.NewMemoryStore(0), &logger{},
+		ratelimit.Rule{Name: "register", Path: "/v1/users", Key: ratelimit.ByIP, Limit: limit})
+	assert.NoError(t, err)
+	realIP, err := clientip.New([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	h := realIP(l.Middleware(ok))
+
+	serve := func(forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/v1/users", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("198.51.100.1"))
+	assert.Equal(t, http.StatusOK, serve("198.51.100.2"), "clients behind the proxy are limited separately")
+	assert.Equal(t, http.StatusTooManyRequests, serve("198.51.100.3, 198.51.100.1"), "spoofed hops are ignored")
+}
+
+func TestUser(t *testing.T) {
+	limit := ratelimit.Limit{Algorithm: ratelimit.TokenBucket, Requests: 1, Window: time.Hour}
+	l, err := ratelimit.New(ratelimit.NewMemoryStore(0), &logger{},
+		ratelimit.Rule{Name: "api", Path: "/*", Key: ratelimit.ByUser, Limit: limit})
+	assert.NoError(t, err)
+
+	auth := func(id string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx := context.WithValue(r.Context(), chisk.KeyString("_authuser"), &chisk.AuthUser{ID: id})
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		}
+	}
+	serve := func(id string) int {
+		req := httptest.NewRequest("GET", "/v1/users", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		l.Middleware(auth(id)(l.User(ok))).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("1"))
+	assert.Equal(t, http.StatusOK, serve("2"), "users sharing IP are limited separately")
+
+	rec := httptest.NewRecorder()
+	l.Middleware(l.User(ok)).ServeHTTP(rec, httptest.NewRequest("GET", "/v1/users", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "requests without credentials are limited by IP")
+	rec = httptest.NewRecorder()
+	l.Middleware(l.User(ok)).ServeHTTP(rec, httptest.NewRequest("GET", "/v1/users", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func TestUnresolvedUser(t *testing.T) {
+	limit := ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Requests: 3, Window: time.Hour}
+	newLimiter := func() *ratelimit.Limiter {
+		l, err := ratelimit.New(ratelimit.NewMemoryStore(0), &logger{},
+			ratelimit.Rule{Name: "api", Path: "/*", Key: ratelimit.ByUser, Limit: limit})
+		assert.NoError(t, err)
+		return l
+	}
+	// reject fails authentication, as it does for invalid tokens
+	reject := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) })
+
+	l := newLimiter()
+	var codes []int
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/v1/users", nil)
+		req.Header.Set("Authorization", "Bearer junk")
+		rec := httptest.NewRecorder()
+		l.Middleware(reject).ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []int{401, 401, 401, 429, 429}, codes, "requests with invalid tokens are limited by IP")
+
+	l = newLimiter()
+	codes = nil
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/v1/users", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		l.Middleware(l.User(ok)).ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []int{200, 200, 200, 429, 429}, codes, "routes without authentication are limited by IP")
+}
+
+func TestMiddlewareStoreError(t *testing.T) {
+	log := &logger{}
+	l, err := ratelimit.New(failingStore{}, log, ratelimit.Rule{
+		Name:  "api",
+		Path:  "/*",
+		Key:   ratelimit.ByIP,
+		Limit: ratelimit.Limit{Algorithm: ratelimit.TokenBucket, Requests: 1, Window: time.Hour},
+	})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	l.Middleware(ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, log.errs, 1)
+}
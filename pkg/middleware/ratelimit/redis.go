@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// NewRedisStore creates Redis backed store, sharing limits between instances
+func NewRedisStore(c *redis.Client) *RedisStore {
+	return &RedisStore{client: c, now: time.Now}
+}
+
+// RedisStore keeps limiter state in Redis
+type RedisStore struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// tokenBucketScript refills and takes a token from the bucket stored under KEYS[1].
+// ARGV holds bucket capacity, refill rate in tokens per microsecond, current time in microseconds,
+// state TTL in milliseconds and 1 to take the token or 0 to only check for it.
+// It returns whether the request is allowed and tokens left.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	allowed = 1
+end
+if ARGV[5] == "0" then
+	return {allowed, tostring(tokens)}
+end
+if allowed == 1 then
+	tokens = tokens - 1
+end
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(ts))
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript counts the request in current window, stored under KEYS[1], unless weighted
+// count of previous window, stored under KEYS[2], and current window reaches the limit.
+// ARGV holds the limit, previous window's weight, state TTL in milliseconds
+// and 1 to count the request or 0 to only check it.
+// It returns whether the request is allowed and both windows' counts.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local curr = tonumber(redis.call("GET", KEYS[1]) or "0")
+local prev = tonumber(redis.call("GET", KEYS[2]) or "0")
+if math.ceil(prev * weight + curr) >= limit then
+	return {0, prev, curr}
+end
+if ARGV[4] == "0" then
+	return {1, prev, curr}
+end
+curr = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return {1, prev, curr}
+`)
+
+// Allow checks whether request identified by key is within limit, counting it if so
+func (s *RedisStore) Allow(_ context.Context, key string, l Limit) (Result, error) {
+	return s.check(key, l, 1)
+}
+
+// Peek checks whether request identified by key would be within limit, without counting it
+func (s *RedisStore) Peek(_ context.Context, key string, l Limit) (Result, error) {
+	return s.check(key, l, 0)
+}
+
+func (s *RedisStore) check(key string, l Limit, count int) (Result, error) {
+	now := s.now()
+	ttl := int64(l.ttl() / time.Millisecond)
+
+	if l.Algorithm == TokenBucket {
+		res, err := tokenBucketScript.Run(s.client, []string{"ratelimit:" + key},
+			l.capacity(), l.rate()*float64(time.Microsecond), now.UnixNano()/int64(time.Microsecond), ttl, count).Result()
+		if err != nil {
+			return Result{}, err
+		}
+		vals, ok := res.([]interface{})
+		if !ok || len(vals) != 2 {
+			return Result{}, fmt.Errorf("unexpected token bucket script result %v", res)
+		}
+		tokens, err := strconv.ParseFloat(fmt.Sprint(vals[1]), 64)
+		if err != nil {
+			return Result{}, err
+		}
+		return tokenBucketResult(l, vals[0] == int64(1), tokens), nil
+	}
+
+	window := now.UnixNano() / int64(l.Window)
+	elapsed := time.Duration(now.UnixNano() - window*int64(l.Window))
+	weight := 1 - float64(elapsed)/float64(l.Window)
+
+	// Hash tags keep both windows in the same Redis Cluster slot
+	keys := []string{
+		fmt.Sprintf("ratelimit:{%s}:%d", key, window),
+		fmt.Sprintf("ratelimit:{%s}:%d", key, window-1),
+	}
+	res, err := slidingWindowScript.Run(s.client, keys, l.Requests, weight, ttl, count).Result()
+	if err != nil {
+		return Result{}, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 3 {
+		return Result{}, fmt.Errorf("unexpected sliding window script result %v", res)
+	}
+	prev, _ := vals[1].(int64)
+	curr, _ := vals[2].(int64)
+	return slidingWindowResult(l, vals[0] == int64(1), int(prev), int(curr), elapsed), nil
+}
@@ -0,0 +1,48 @@
+package ratelimit_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	dockertest "gopkg.in/ory-am/dockertest.v3"
+
+	"github.com/ribice/chisk/pkg/middleware/ratelimit"
+	"github.com/ribice/chisk/pkg/redis"
+)
+
+func TestRedisStore(t *testing.T) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.Run("redis", "4.0.11", nil)
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+	defer pool.Purge(resource)
+
+	port, _ := strconv.Atoi(resource.GetPort("6379/tcp"))
+	rclient, err := redis.New("localhost", "", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ratelimit.NewRedisStore(rclient)
+
+	for _, alg := range []ratelimit.Algorithm{ratelimit.TokenBucket, ratelimit.SlidingWindow} {
+		limit := ratelimit.Limit{Algorithm: alg, Requests: 2, Window: 24 * time.Hour}
+		for i, want := range []bool{true, true, false} {
+			peeked, err := s.Peek(context.Background(), string(alg)+":ip:127.0.0.1", limit)
+			assert.NoError(t, err)
+			assert.Equal(t, want, peeked.Allowed, "%s peek %d does not count the request", alg, i)
+
+			res, err := s.Allow(context.Background(), string(alg)+":ip:127.0.0.1", limit)
+			assert.NoError(t, err)
+			assert.Equal(t, want, res.Allowed, "%s request %d", alg, i)
+			assert.Equal(t, 2, res.Limit)
+		}
+	}
+}
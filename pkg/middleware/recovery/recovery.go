@@ -0,0 +1,76 @@
+// Package recovery recovers panics in HTTP handlers, responding with internal server error
+// and logging the panic along with its stack trace.
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/middleware/wrap"
+)
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
+}
+
+// Sink receives recovered panics, e.g. to report them to an error tracking service
+type Sink interface {
+	Report(ctx context.Context, err error, stack []byte)
+}
+
+// SinkFunc adapts ordinary function to Sink
+type SinkFunc func(ctx context.Context, err error, stack []byte)
+
+// Report calls f(ctx, err, stack)
+func (f SinkFunc) Report(ctx context.Context, err error, stack []byte) {
+	f(ctx, err, stack)
+}
+
+// New creates middleware recovering panics of next handlers.
+// Panics are logged with their stack and reported to sinks, and clients get the standard internal error response.
+// It has to run after request ID and logging middleware for logs to include request ID.
+func New(log Logger, sinks ...Sink) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			rw := wrap.New(w)
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// ErrAbortHandler is used to abort response on purpose, and is handled by net/http
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				err, ok := rec.(error)
+				if !ok {
+					err = fmt.Errorf("%v", rec)
+				}
+				stack := debug.Stack()
+
+				ctx := r.Context()
+				log.Log(ctx, "recovery", "Recovered from panic", err, map[string]interface{}{
+					"method": r.Method,
+					"path":   r.URL.Path,
+					"stack":  string(stack),
+				})
+				for _, s := range sinks {
+					s.Report(ctx, err, stack)
+				}
+
+				// Response that has already started cannot be replaced.
+				// The panic is already logged, so the cause is not passed on to be logged again.
+				if !rw.Wrote() {
+					apperr.Write(rw, r, apperr.ErrInternal)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
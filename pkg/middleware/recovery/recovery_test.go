@@ -0,0 +1,101 @@
+package recovery_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/recovery"
+)
+
+type logEntry struct {
+	msg    string
+	err    error
+	params map[string]interface{}
+}
+
+type logger struct {
+	entries []logEntry
+}
+
+func (l *logger) Log(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
+	l.entries = append(l.entries, logEntry{msg: msg, err: err, params: params})
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBody   string
+		wantErr    string
+	}{
+		{
+			name:       "No panic",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "Panic with string",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic("something went wrong") },
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"code":"internal","message":"Internal server error"}`,
+			wantErr:    "something went wrong",
+		},
+		{
+			name:       "Panic with error",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic(errors.New("nil map")) },
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"code":"internal","message":"Internal server error"}`,
+			wantErr:    "nil map",
+		},
+		{
+			name: "Panic after response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("too late")
+			},
+			wantStatus: http.StatusAccepted,
+			wantErr:    "too late",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &logger{}
+			var reported error
+			sink := recovery.SinkFunc(func(ctx context.Context, err error, stack []byte) { reported = err })
+
+			rec := httptest.NewRecorder()
+			recovery.New(log, sink)(tt.handler).ServeHTTP(rec, httptest.NewRequest("GET", "/users", nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantBody, strings.TrimSpace(rec.Body.String()))
+			if tt.wantErr == "" {
+				assert.Empty(t, log.entries)
+				assert.Nil(t, reported)
+				return
+			}
+			if !assert.Len(t, log.entries, 1) {
+				return
+			}
+			assert.EqualError(t, log.entries[0].err, tt.wantErr)
+			assert.Equal(t, "/users", log.entries[0].params["path"])
+			assert.Contains(t, log.entries[0].params["stack"], "recovery_test.go")
+			assert.EqualError(t, reported, tt.wantErr)
+		})
+	}
+}
+
+func TestNewAbortHandler(t *testing.T) {
+	h := recovery.New(&logger{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+}
@@ -0,0 +1,95 @@
+// Package secure sets security headers on responses and redirects plain HTTP requests to HTTPS.
+package secure
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Header defaults, used when options leave them empty.
+// The API serves only JSON, so documents are not allowed to load anything or be framed.
+const (
+	DefaultFrameOptions          = "DENY"
+	DefaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	DefaultReferrerPolicy        = "no-referrer"
+)
+
+// Options configures security headers
+type Options struct {
+	// HSTSMaxAge is how long browsers should only use HTTPS, Strict-Transport-Security is not sent if zero
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	FrameOptions          string
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+
+	// TrustForwardedProto treats requests with X-Forwarded-Proto: https as secure,
+	// when TLS is terminated by a proxy
+	TrustForwardedProto bool
+}
+
+// Headers creates middleware setting security headers on every response.
+// Strict-Transport-Security is only sent over HTTPS, as browsers ignore it otherwise.
+func Headers(o Options) func(http.Handler) http.Handler {
+	if o.FrameOptions == "" {
+		o.FrameOptions = DefaultFrameOptions
+	}
+	if o.ContentSecurityPolicy == "" {
+		o.ContentSecurityPolicy = DefaultContentSecurityPolicy
+	}
+	if o.ReferrerPolicy == "" {
+		o.ReferrerPolicy = DefaultReferrerPolicy
+	}
+
+	var hsts string
+	if o.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(o.HSTSMaxAge/time.Second))
+		if o.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if o.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", o.FrameOptions)
+			h.Set("Content-Security-Policy", o.ContentSecurityPolicy)
+			h.Set("Referrer-Policy", o.ReferrerPolicy)
+			if hsts != "" && (r.TLS != nil || o.TrustForwardedProto && r.Header.Get("X-Forwarded-Proto") == "https") {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RedirectHTTPS redirects requests to the same URL over HTTPS, served on tlsPort, e.g. :443
+func RedirectHTTPS(tlsPort string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsPort)
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			// Keeps method and body of redirected request
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,133 @@
+package secure_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/secure"
+)
+
+func TestHeaders(t *testing.T) {
+	cases := []struct {
+		name        string
+		opts        secure.Options
+		tls         bool
+		proto       string
+		wantHeaders map[string]string
+	}{
+		{
+			name: "Defaults",
+			wantHeaders: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+				"Referrer-Policy":           "no-referrer",
+				"Strict-Transport-Security": "",
+			},
+		},
+		{
+			name: "Overrides",
+			opts: secure.Options{
+				FrameOptions:          "SAMEORIGIN",
+				ContentSecurityPolicy: "default-src 'self'",
+				ReferrerPolicy:        "strict-origin",
+			},
+			wantHeaders: map[string]string{
+				"X-Frame-Options":         "SAMEORIGIN",
+				"Content-Security-Policy": "default-src 'self'",
+				"Referrer-Policy":         "strict-origin",
+			},
+		},
+		{
+			name:        "HSTS over plain HTTP",
+			opts:        secure.Options{HSTSMaxAge: time.Hour},
+			wantHeaders: map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			name:        "HSTS over TLS",
+			opts:        secure.Options{HSTSMaxAge: 365 * 24 * time.Hour, HSTSIncludeSubdomains: true, HSTSPreload: true},
+			tls:         true,
+			wantHeaders: map[string]string{"Strict-Transport-Security": "max-age=31536000; includeSubDomains; preload"},
+		},
+		{
+			name:        "HSTS with untrusted forwarded proto",
+			opts:        secure.Options{HSTSMaxAge: time.Hour},
+			proto:       "https",
+			wantHeaders: map[string]string{"Strict-Transport-Security": ""},
+		},
+		{
+			name:        "HSTS behind proxy",
+			opts:        secure.Options{HSTSMaxAge: time.Hour, TrustForwardedProto: true},
+			proto:       "https",
+			wantHeaders: map[string]string{"Strict-Transport-Security": "max-age=3600"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/users", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			rec := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			secure.Headers(tt.opts)(next).ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			for k, v := range tt.wantHeaders {
+				assert.Equal(t, v, rec.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	cases := []struct {
+		name         string
+		tlsPort      string
+		method       string
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "Default port",
+			tlsPort:      ":443",
+			method:       "GET",
+			target:       "http://api.chisk.io/v1/users?limit=10",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://api.chisk.io/v1/users?limit=10",
+		},
+		{
+			name:         "Custom port",
+			tlsPort:      ":8443",
+			method:       "GET",
+			target:       "http://localhost:8080/v1/users",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://localhost:8443/v1/users",
+		},
+		{
+			name:         "Keeps method",
+			tlsPort:      ":443",
+			method:       "POST",
+			target:       "http://api.chisk.io/v1/users",
+			wantStatus:   http.StatusPermanentRedirect,
+			wantLocation: "https://api.chisk.io/v1/users",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			secure.RedirectHTTPS(tt.tlsPort).ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+		})
+	}
+}
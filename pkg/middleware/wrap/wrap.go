@@ -0,0 +1,60 @@
+// Package wrap records what handlers write to responses, for middleware reporting on them.
+package wrap
+
+import "net/http"
+
+// New wraps w, recording the response written through it
+func New(w http.ResponseWriter) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+// ResponseWriter records response status, size and whether the response has started
+type ResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	wrote  bool
+}
+
+// Status returns response status, 200 if handler did not set one
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// Bytes returns number of body bytes written
+func (w *ResponseWriter) Bytes() int {
+	return w.bytes
+}
+
+// Wrote reports whether the response has started, after which it cannot be replaced
+func (w *ResponseWriter) Wrote() bool {
+	return w.wrote
+}
+
+// WriteHeader records status of the response, unless it has already started
+func (w *ResponseWriter) WriteHeader(status int) {
+	if !w.wrote {
+		w.status = status
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does
+func (w *ResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,64 @@
+package wrap_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/middleware/wrap"
+)
+
+func TestResponseWriter(t *testing.T) {
+	cases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int
+		wantWrote  bool
+	}{
+		{
+			name:       "Nothing written",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Status and body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("short"))
+				w.Write([]byte(" and stout"))
+			},
+			wantStatus: http.StatusTeapot,
+			wantBytes:  len("short and stout"),
+			wantWrote:  true,
+		},
+		{
+			name: "Implicit status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusOK,
+			wantBytes:  2,
+			wantWrote:  true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rw := wrap.New(rec)
+			tt.handler(rw, httptest.NewRequest("GET", "/", nil))
+
+			assert.Equal(t, tt.wantStatus, rw.Status())
+			assert.Equal(t, tt.wantBytes, rw.Bytes())
+			assert.Equal(t, tt.wantWrote, rw.Wrote())
+			assert.Equal(t, rec, rw.Unwrap())
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	wrap.New(rec).Flush()
+	assert.True(t, rec.Flushed)
+}
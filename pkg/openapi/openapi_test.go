@@ -0,0 +1,145 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/openapi"
+)
+
+type base struct {
+	ID        string     `json:"id" validate:"required"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type tag struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type node struct {
+	base
+	Title    string            `json:"title" validate:"required,max=100"`
+	Secret   string            `json:"-"`
+	Score    float64           `json:"score,omitempty"`
+	Tags     []tag             `json:"tags"`
+	Children []*node           `json:"children,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Extra    interface{}       `json:"extra,omitempty"`
+	Untagged int64
+	internal bool
+}
+
+func TestSchema(t *testing.T) {
+	d := openapi.New("test", "1.0.0")
+
+	assert.Equal(t, &openapi.Schema{Ref: "#/components/schemas/node"}, d.Schema(&node{}))
+	assert.Equal(t, &openapi.Schema{Type: "array", Items: &openapi.Schema{Ref: "#/components/schemas/tag"}}, d.Schema([]tag{}))
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "date-time"}, d.Schema(time.Time{}))
+
+	dateTime := &openapi.Schema{Type: "string", Format: "date-time"}
+	assert.Equal(t, &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"id":         {Type: "string"},
+			"created_at": dateTime,
+			"deleted_at": dateTime,
+			"title":      {Type: "string"},
+			"score":      {Type: "number", Format: "double"},
+			"tags":       {Type: "array", Items: &openapi.Schema{Ref: "#/components/schemas/tag"}},
+			"children":   {Type: "array", Items: &openapi.Schema{Ref: "#/components/schemas/node"}},
+			"meta":       {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}},
+			"data":       {Type: "string", Format: "byte"},
+			"extra":      {},
+			"Untagged":   {Type: "integer", Format: "int64"},
+		},
+		Required: []string{"id", "title"},
+	}, d.Components.Schemas["node"])
+	assert.Equal(t, &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"name": {Type: "string"}},
+		Required:   []string{"name"},
+	}, d.Components.Schemas["tag"])
+	assert.Len(t, d.Components.Schemas, 2)
+}
+
+func TestAdd(t *testing.T) {
+	d := openapi.New("test", "1.0.0")
+	d.Add("DELETE", "/users/{id}/sessions", &openapi.Operation{
+		Responses: map[string]*openapi.Response{"204": d.JSONResponse("Sessions revoked", nil)},
+	})
+
+	op := d.Operation("DELETE", "/users/{id}/sessions")
+	if assert.NotNil(t, op) {
+		assert.Equal(t, []openapi.Parameter{{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}}, op.Parameters)
+	}
+	assert.Nil(t, d.Operation("GET", "/users/{id}/sessions"))
+	assert.Nil(t, d.Operation("DELETE", "/users"))
+}
+
+func TestServeHTTP(t *testing.T) {
+	d := openapi.New("chisk", "1.0.0")
+	d.Add("POST", "/users", &openapi.Operation{
+		RequestBody: d.JSONBody("New tag", tag{}),
+		Responses:   map[string]*openapi.Response{"201": d.JSONResponse("Created tag", tag{})},
+	})
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/docs/openapi.json", nil))
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc["openapi"])
+	assert.JSONEq(t, `{"users":{"post":{
+		"requestBody":{"description":"New tag","required":true,"content":{"application/json":{"schema":{"$ref":"#/components/schemas/tag"}}}},
+		"responses":{"201":{"description":"Created tag","content":{"application/json":{"schema":{"$ref":"#/components/schemas/tag"}}}}}
+	}}}`, mustJSON(t, map[string]interface{}{"users": doc["paths"].(map[string]interface{})["/users"]}))
+}
+
+func TestUI(t *testing.T) {
+	cases := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantType     string
+		wantBody     string
+		wantLocation string
+	}{
+		{name: "Page", path: "/docs/", wantStatus: http.StatusOK, wantType: "text/html; charset=utf-8", wantBody: "swagger-ui-bundle.js"},
+		{name: "Init script", path: "/docs/init.js", wantStatus: http.StatusOK, wantType: "application/javascript", wantBody: `url: "/docs/openapi.json"`},
+		{name: "Script", path: "/docs/swagger-ui-bundle.js", wantStatus: http.StatusOK, wantType: "text/javascript; charset=utf-8", wantBody: "SwaggerUIBundle"},
+		{name: "Stylesheet", path: "/docs/swagger-ui.css", wantStatus: http.StatusOK, wantType: "text/css; charset=utf-8", wantBody: ".swagger-ui"},
+		{name: "Redirect", path: "/docs", wantStatus: http.StatusMovedPermanently, wantLocation: "/docs/"},
+		{name: "Unknown asset", path: "/docs/swagger-ui-bundle.js.map", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			openapi.UI("/docs/openapi.json").ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Security-Policy"), "script-src 'self';")
+			assert.NotContains(t, w.Header().Get("Content-Security-Policy"), "https:")
+			assert.Equal(t, tt.wantLocation, w.Header().Get("Location"))
+			if tt.wantType != "" {
+				assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+			}
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
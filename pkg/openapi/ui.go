@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SwaggerUIVersion is the version of Swagger UI assets embedded into the binary
+const SwaggerUIVersion = "4.15.5"
+
+// assets holds swagger-ui-bundle.js and swagger-ui.css copied from swagger-ui-dist package
+//
+//go:embed swagger-ui
+var assets embed.FS
+
+const (
+	// uiPolicy allows the page to load its assets and fetch the document from the API only.
+	// Initialization script is served separately, as inline scripts are not allowed.
+	uiPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; img-src 'self' data:; " +
+		"connect-src 'self'; frame-ancestors 'none'"
+
+	uiPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>API documentation</title>
+<link rel="stylesheet" href="swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="swagger-ui-bundle.js"></script>
+<script src="init.js"></script>
+</body>
+</html>
+`
+)
+
+// UI creates handler serving Swagger UI for document at specURL.
+// It serves the page on paths ending with a slash and its assets next to it, redirecting other paths
+// without extension to the page, e.g. /docs to /docs/.
+func UI(specURL string) http.Handler {
+	url, _ := json.Marshal(specURL)
+	initScript := "window.ui = SwaggerUIBundle({url: " + string(url) + ", dom_id: '#swagger-ui'});\n"
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", uiPolicy)
+		name := path.Base(r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/"):
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(uiPage))
+		case name == "init.js":
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Write([]byte(initScript))
+		case name == "swagger-ui-bundle.js" || name == "swagger-ui.css":
+			http.ServeFileFS(w, r, assets, "swagger-ui/"+name)
+		case path.Ext(name) == "":
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,334 @@
+package pgsql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+
+	"github.com/ribice/chisk/pkg/apperr"
+)
+
+// ErrInvalidQuery is the cause of errors returned when list query parameters are invalid.
+// Those errors are API errors responding with 400 invalid_query and the reason.
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// invalidQuery creates API error describing why list query is invalid
+func invalidQuery(format string, args ...interface{}) error {
+	return apperr.New(http.StatusBadRequest, "invalid_query", fmt.Sprintf(format, args...)).Wrap(ErrInvalidQuery)
+}
+
+// Pagination defaults
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// FieldType determines how filter values are parsed and which operators they support
+type FieldType int
+
+// Filterable field types
+const (
+	String FieldType = iota
+	Int
+	Bool
+	Time
+)
+
+// Op represents filter operator
+type Op string
+
+// Filter operators, used in query parameters as field[op]=value
+const (
+	Eq   Op = "eq"
+	Ne   Op = "ne"
+	Lt   Op = "lt"
+	Lte  Op = "lte"
+	Gt   Op = "gt"
+	Gte  Op = "gte"
+	In   Op = "in"
+	Like Op = "like"
+)
+
+var (
+	opSQL = map[Op]string{Eq: "=", Ne: "<>", Lt: "<", Lte: "<=", Gt: ">", Gte: ">="}
+
+	typeOps = map[FieldType][]Op{
+		String: {Eq, Ne, In, Like},
+		Int:    {Eq, Ne, Lt, Lte, Gt, Gte, In},
+		Bool:   {Eq, Ne},
+		Time:   {Eq, Ne, Lt, Lte, Gt, Gte},
+	}
+
+	likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+)
+
+// Ops returns filter operators supported by fields of type t
+func (t FieldType) Ops() []Op {
+	return typeOps[t]
+}
+
+// ListSpec whitelists columns a model can be sorted and filtered by.
+// Cursor values are parsed with the type of their sort field in Filterable, so pages sorted by
+// fields that are not filterable can be fetched with offset pagination only.
+type ListSpec struct {
+	Sortable   []string
+	Filterable map[string]FieldType
+
+	// DefaultSort is used when no sort is requested, "-created_at" if empty
+	DefaultSort string
+}
+
+// ListQuery represents validated filtering, sorting and pagination parameters
+type ListQuery struct {
+	Filters []Filter
+	Sort    string
+	Desc    bool
+	Limit   int
+	Offset  int
+	Cursor  *Cursor
+}
+
+// Filter represents a condition on a column
+type Filter struct {
+	Field string
+	Op    Op
+	Value interface{}
+}
+
+// Cursor points after the last row of a page, by its sort column value and ID
+type Cursor struct {
+	Sort  string
+	Value interface{}
+	ID    string
+}
+
+// Page contains pagination details of a list
+type Page struct {
+	// Total is the number of rows matching filters, set for offset pagination only
+	Total int `json:"total,omitempty"`
+
+	// NextCursor fetches the next page, empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ParseListQuery parses query parameters into list query, allowing fields whitelisted by spec only:
+//
+//	?sort=-created_at        sort by created_at, descending
+//	?limit=20&offset=40      offset pagination
+//	?limit=20&cursor=...     cursor pagination, using next_cursor of the previous page
+//	?email=john@example.org  filter by equality
+//	?role[in]=2,3            filter using operator, one of eq, ne, lt, lte, gt, gte, in and like
+//
+// Parameters not naming a filterable field are ignored.
+func ParseListQuery(v url.Values, spec ListSpec) (ListQuery, error) {
+	q := ListQuery{Limit: DefaultLimit}
+
+	defaultSort := spec.DefaultSort
+	if defaultSort == "" {
+		defaultSort = "-created_at"
+	}
+	sortBy := v.Get("sort")
+	if sortBy == "" {
+		sortBy = defaultSort
+	}
+	q.Desc = strings.HasPrefix(sortBy, "-")
+	q.Sort = strings.TrimPrefix(sortBy, "-")
+	if !contains(spec.Sortable, q.Sort) && q.Sort != strings.TrimPrefix(defaultSort, "-") {
+		return q, invalidQuery("cannot sort by %q", q.Sort)
+	}
+
+	var err error
+	if l := v.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 1 || q.Limit > MaxLimit {
+			return q, invalidQuery("limit must be between 1 and %d", MaxLimit)
+		}
+	}
+	if o := v.Get("offset"); o != "" {
+		if q.Offset, err = strconv.Atoi(o); err != nil || q.Offset < 0 {
+			return q, invalidQuery("offset must be a positive number")
+		}
+	}
+	if c := v.Get("cursor"); c != "" {
+		if q.Offset > 0 {
+			return q, invalidQuery("cursor and offset are mutually exclusive")
+		}
+		if q.Cursor, err = decodeCursor(c, q.Sort, spec); err != nil {
+			return q, invalidQuery("%v", err)
+		}
+	}
+
+	// Parameters are sorted so that filters are applied in a stable order
+	params := make([]string, 0, len(v))
+	for p := range v {
+		params = append(params, p)
+	}
+	sort.Strings(params)
+
+	for _, p := range params {
+		field, op := p, Eq
+		if i := strings.IndexByte(p, '['); i > 0 && strings.HasSuffix(p, "]") {
+			field, op = p[:i], Op(p[i+1:len(p)-1])
+		}
+		typ, ok := spec.Filterable[field]
+		if !ok {
+			continue
+		}
+		f, err := parseFilter(field, op, typ, v.Get(p))
+		if err != nil {
+			return q, err
+		}
+		q.Filters = append(q.Filters, f)
+	}
+
+	return q, nil
+}
+
+func parseFilter(field string, op Op, typ FieldType, raw string) (Filter, error) {
+	if !containsOp(typeOps[typ], op) {
+		return Filter{}, invalidQuery("operator %q is not supported for %s", op, field)
+	}
+
+	f := Filter{Field: field, Op: op}
+	if op == In {
+		var values []interface{}
+		for _, s := range strings.Split(raw, ",") {
+			v, err := parseValue(typ, s)
+			if err != nil {
+				return Filter{}, invalidQuery("invalid %s value %q", field, s)
+			}
+			values = append(values, v)
+		}
+		f.Value = values
+		return f, nil
+	}
+
+	v, err := parseValue(typ, raw)
+	if err != nil {
+		return Filter{}, invalidQuery("invalid %s value %q", field, raw)
+	}
+	f.Value = v
+	return f, nil
+}
+
+func parseValue(typ FieldType, s string) (interface{}, error) {
+	switch typ {
+	case Int:
+		return strconv.ParseInt(s, 10, 64)
+	case Bool:
+		return strconv.ParseBool(s)
+	case Time:
+		return time.Parse(time.RFC3339, s)
+	default:
+		return s, nil
+	}
+}
+
+// Apply adds filters, cursor, order and limit to the query, fetching one row more than the limit
+// to tell whether there is a next page. Use it with orm.Query.Apply.
+func (l ListQuery) Apply(q *orm.Query) (*orm.Query, error) {
+	for _, f := range l.Filters {
+		switch f.Op {
+		case In:
+			q = q.Where("?TableAlias.? IN (?)", pg.F(f.Field), pg.In(f.Value))
+		case Like:
+			q = q.Where("?TableAlias.? ILIKE ?", pg.F(f.Field), "%"+likeEscaper.Replace(f.Value.(string))+"%")
+		default:
+			q = q.Where("?TableAlias.? "+opSQL[f.Op]+" ?", pg.F(f.Field), f.Value)
+		}
+	}
+
+	dir, cmp := "ASC", ">"
+	if l.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if l.Cursor != nil {
+		q = q.Where("(?TableAlias.?, ?TableAlias.id) "+cmp+" (?, ?)", pg.F(l.Sort), l.Cursor.Value, l.Cursor.ID)
+	}
+
+	return q.OrderExpr("?TableAlias.? "+dir+", ?TableAlias.id "+dir, pg.F(l.Sort)).
+		Limit(l.Limit + 1).
+		Offset(l.Offset), nil
+}
+
+// Encode encodes cursor for use in query parameters
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal([]interface{}{c.Sort, c.Value, c.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor decodes cursor made for pages sorted by sortBy, parsing its value with the field's type
+func decodeCursor(s, sortBy string, spec ListSpec) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	// Numbers are kept as strings so that large integers don't lose precision
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	var v []interface{}
+	if err := d.Decode(&v); err != nil || len(v) != 3 {
+		return nil, errors.New("malformed cursor")
+	}
+
+	sortField, ok := v[0].(string)
+	if !ok || sortField != sortBy {
+		return nil, fmt.Errorf("cursor was not made for sorting by %q", sortBy)
+	}
+	typ, ok := spec.Filterable[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("cannot use cursor when sorting by %q", sortBy)
+	}
+
+	var raw string
+	switch val := v[1].(type) {
+	case string:
+		raw = val
+	case json.Number:
+		raw = val.String()
+	case bool:
+		raw = strconv.FormatBool(val)
+	default:
+		return nil, errors.New("malformed cursor")
+	}
+	value, err := parseValue(typ, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %s value %q", sortBy, raw)
+	}
+
+	id, ok := v[2].(string)
+	if !ok || id == "" {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return &Cursor{Sort: sortBy, Value: value, ID: id}, nil
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOp(ops []Op, op Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
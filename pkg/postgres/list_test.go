@@ -0,0 +1,167 @@
+package pgsql_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/apperr"
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+var spec = pgsql.ListSpec{
+	Sortable: []string{"email", "role"},
+	Filterable: map[string]pgsql.FieldType{
+		"email":      pgsql.String,
+		"role":       pgsql.Int,
+		"is_active":  pgsql.Bool,
+		"created_at": pgsql.Time,
+	},
+}
+
+func TestParseListQuery(t *testing.T) {
+	cursor := pgsql.Cursor{Sort: "email", Value: "john@example.org", ID: "uid"}
+	roleCursor := pgsql.Cursor{Sort: "role", Value: 3, ID: "uid"}
+
+	cases := []struct {
+		name     string
+		query    string
+		wantData pgsql.ListQuery
+		wantErr  bool
+	}{
+		{
+			name:     "Defaults",
+			wantData: pgsql.ListQuery{Sort: "created_at", Desc: true, Limit: pgsql.DefaultLimit},
+		},
+		{
+			name:    "Sort field not whitelisted",
+			query:   "sort=password",
+			wantErr: true,
+		},
+		{
+			name:    "Limit too large",
+			query:   "limit=1000",
+			wantErr: true,
+		},
+		{
+			name:    "Cursor with offset",
+			query:   "offset=20&cursor=" + cursor.Encode(),
+			wantErr: true,
+		},
+		{
+			name:    "Malformed cursor",
+			query:   "cursor=invalid",
+			wantErr: true,
+		},
+		{
+			name:    "Cursor made for another sort",
+			query:   "sort=role&cursor=" + cursor.Encode(),
+			wantErr: true,
+		},
+		{
+			name:    "Cursor with object value",
+			query:   "sort=role&cursor=" + pgsql.Cursor{Sort: "role", Value: map[string]int{"a": 1}, ID: "uid"}.Encode(),
+			wantErr: true,
+		},
+		{
+			name:    "Cursor with value of another type",
+			query:   "sort=created_at&cursor=" + pgsql.Cursor{Sort: "created_at", Value: "john@example.org", ID: "uid"}.Encode(),
+			wantErr: true,
+		},
+		{
+			name:    "Cursor without ID",
+			query:   "sort=role&cursor=" + pgsql.Cursor{Sort: "role", Value: 3}.Encode(),
+			wantErr: true,
+		},
+		{
+			name:     "Cursor value parsed with sort field type",
+			query:    "sort=-role&cursor=" + roleCursor.Encode(),
+			wantData: pgsql.ListQuery{Sort: "role", Desc: true, Limit: pgsql.DefaultLimit, Cursor: &pgsql.Cursor{Sort: "role", Value: int64(3), ID: "uid"}},
+		},
+		{
+			name:    "Unsupported operator",
+			query:   "is_active[gt]=true",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid value",
+			query:   "role[in]=1,admin",
+			wantErr: true,
+		},
+		{
+			name:  "Success",
+			query: "sort=email&limit=10&cursor=" + cursor.Encode() + "&role[in]=2,3&is_active=true&created_at[gte]=2018-01-02T15:04:05Z&keep_current=true",
+			wantData: pgsql.ListQuery{
+				Sort:   "email",
+				Limit:  10,
+				Cursor: &cursor,
+				Filters: []pgsql.Filter{
+					{Field: "created_at", Op: pgsql.Gte, Value: time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)},
+					{Field: "is_active", Op: pgsql.Eq, Value: true},
+					{Field: "role", Op: pgsql.In, Value: []interface{}{int64(2), int64(3)}},
+				},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := url.ParseQuery(tt.query)
+			q, err := pgsql.ParseListQuery(v, spec)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, pgsql.ErrInvalidQuery))
+				e := apperr.From(err)
+				assert.Equal(t, http.StatusBadRequest, e.Status)
+				assert.Equal(t, "invalid_query", e.Code)
+				return
+			}
+			assert.Equal(t, tt.wantData, q)
+		})
+	}
+}
+
+func TestListQueryApply(t *testing.T) {
+	cases := []struct {
+		name  string
+		query pgsql.ListQuery
+		want  string
+	}{
+		{
+			name:  "Offset",
+			query: pgsql.ListQuery{Sort: "created_at", Desc: true, Limit: 20, Offset: 40},
+			want:  `SELECT "user"."id", "user"."created_at", "user"."updated_at", "user"."deleted_at", "user"."email", "user"."display_name", "user"."first_name", "user"."last_name", "user"."password", "user"."phone_number", "user"."token", "user"."is_active", "user"."role", "user"."last_password_change" FROM "users" AS "user" WHERE ("user".deleted_at IS NULL) ORDER BY "user"."created_at" DESC, "user".id DESC LIMIT 21 OFFSET 40`,
+		},
+		{
+			name: "Filters and cursor",
+			query: pgsql.ListQuery{
+				Sort:   "email",
+				Limit:  10,
+				Cursor: &pgsql.Cursor{Sort: "email", Value: "john@example.org", ID: "uid"},
+				Filters: []pgsql.Filter{
+					{Field: "email", Op: pgsql.Like, Value: "50%_off"},
+					{Field: "role", Op: pgsql.In, Value: []interface{}{int64(2), int64(3)}},
+					{Field: "is_active", Op: pgsql.Ne, Value: false},
+				},
+			},
+			want: `SELECT "user"."id", "user"."created_at", "user"."updated_at", "user"."deleted_at", "user"."email", "user"."display_name", "user"."first_name", "user"."last_name", "user"."password", "user"."phone_number", "user"."token", "user"."is_active", "user"."role", "user"."last_password_change" FROM "users" AS "user" WHERE ("user".deleted_at IS NULL) AND ("user"."email" ILIKE '%50\%\_off%') AND ("user"."role" IN (2,3)) AND ("user"."is_active" <> FALSE) AND (("user"."email", "user".id) > ('john@example.org', 'uid')) ORDER BY "user"."email" ASC, "user".id ASC LIMIT 11`,
+		},
+	}
+
+	db := pg.Connect(&pg.Options{})
+	defer db.Close()
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var users []chisk.User
+			b, err := pgsql.Model(db, &users).Apply(tt.query.Apply).AppendQuery(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// lockID is the advisory lock key held while migrations run, so concurrent instances don't race
+const lockID = 7283749201
+
+var (
+	fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	nameRe = regexp.MustCompile(`^\w+$`)
+)
+
+// Migration represents a versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status represents migration's state in the database
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// New creates new migrator for SQL migrations found in fsys.
+// Migrations are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+func New(db *pg.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Migrator applies and rolls back migrations
+type Migrator struct {
+	db         *pg.DB
+	migrations []Migration
+}
+
+// Load reads migrations from fsys, sorted by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, f := range files {
+		m := fileRe.FindStringSubmatch(f.Name())
+		if f.IsDir() || m == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		b, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations, returning the applied ones
+func (m *Migrator) Up() ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(tx *pg.Tx, applied map[int64]time.Time) error {
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if _, err := tx.Exec(mig.Up); err != nil {
+				return fmt.Errorf("applying migration %d_%s: %v", mig.Version, mig.Name, err)
+			}
+			if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", mig.Version, mig.Name); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// Down rolls back given number of most recently applied migrations, returning the rolled back ones
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(func(tx *pg.Tx, applied map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s is missing down script", mig.Version, mig.Name)
+			}
+			if _, err := tx.Exec(mig.Down); err != nil {
+				return fmt.Errorf("rolling back migration %d_%s: %v", mig.Version, mig.Name, err)
+			}
+			if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// Status returns all known migrations along with the time they were applied at
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+	err := m.locked(func(_ *pg.Tx, applied map[int64]time.Time) error {
+		for _, mig := range m.migrations {
+			s := Status{Migration: mig}
+			if t, ok := applied[mig.Version]; ok {
+				s.AppliedAt = &t
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+type appliedMigration struct {
+	Version   int64
+	AppliedAt time.Time
+}
+
+// locked runs fn in a transaction holding the migrations advisory lock.
+// The lock is released when the transaction ends.
+func (m *Migrator) locked(fn func(*pg.Tx, map[int64]time.Time) error) error {
+	return m.db.RunInTransaction(func(tx *pg.Tx) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`); err != nil {
+			return err
+		}
+
+		var rows []appliedMigration
+		if _, err := tx.Query(&rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+			return err
+		}
+
+		applied := make(map[int64]time.Time, len(rows))
+		for _, r := range rows {
+			applied[r.Version] = r.AppliedAt
+		}
+
+		return fn(tx, applied)
+	})
+}
+
+// Create creates empty up and down migration files in dir, numbered after the latest existing migration
+func Create(dir, name string) (up, down string, err error) {
+	if !nameRe.MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q, use letters, digits and underscores only", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	var version int64 = 1
+	if n := len(migrations); n > 0 {
+		version = migrations[n-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down = base+".up.sql", base+".down.sql"
+
+	if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- Revert "+name+"\n"), 0644); err != nil {
+		return "", "", err
+	}
+
+	return up, down, nil
+}
@@ -0,0 +1,145 @@
+package migrate_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-pg/pg"
+	"github.com/ory/dockertest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/internal/migrations"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/postgres/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		name     string
+		fs       fstest.MapFS
+		wantData []migrate.Migration
+		wantErr  bool
+	}{
+		{
+			name: "Missing up script",
+			fs: fstest.MapFS{
+				"0001_init.down.sql": {Data: []byte("DROP TABLE a;")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Conflicting names",
+			fs: fstest.MapFS{
+				"0001_init.up.sql":  {Data: []byte("CREATE TABLE a();")},
+				"0001_other.up.sql": {Data: []byte("CREATE TABLE b();")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Success",
+			fs: fstest.MapFS{
+				"0010_second.up.sql": {Data: []byte("CREATE TABLE b();")},
+				"0002_init.up.sql":   {Data: []byte("CREATE TABLE a();")},
+				"0002_init.down.sql": {Data: []byte("DROP TABLE a;")},
+				"README.md":          {Data: []byte("ignored")},
+			},
+			wantData: []migrate.Migration{
+				{Version: 2, Name: "init", Up: "CREATE TABLE a();", Down: "DROP TABLE a;"},
+				{Version: 10, Name: "second", Up: "CREATE TABLE b();"},
+			},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := migrate.Load(tt.fs)
+			assert.Equal(t, tt.wantData, ms)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ms, err := migrate.Load(migrations.FS)
+	assert.NoError(t, err)
+	for i, m := range ms {
+		assert.Equal(t, int64(i+1), m.Version)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := os.MkdirTemp("", "migrations")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, _, err = migrate.Create(dir, "invalid-name")
+	assert.Error(err)
+
+	up, down, err := migrate.Create(dir, "create_teams")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(dir, "0001_create_teams.up.sql"), up)
+	assert.Equal(filepath.Join(dir, "0001_create_teams.down.sql"), down)
+
+	up, _, err = migrate.Create(dir, "add_team_owner")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(dir, "0002_add_team_owner.up.sql"), up)
+}
+
+func TestMigrator(t *testing.T) {
+	assert := assert.New(t)
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.Run("postgres", "9.6.5-alpine", []string{"POSTGRES_PASSWORD=secret", "POSTGRES_DB=test"})
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+	defer pool.Purge(resource)
+
+	var db *pg.DB
+	dbConnStr := fmt.Sprintf("postgres://postgres:secret@%s/test?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	if err = pool.Retry(func() error {
+		db, err = pgsql.New(dbConnStr, pgsql.Options{})
+		return err
+	}); err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	m, err := migrate.New(db, migrations.FS)
+	assert.NoError(err)
+
+	all, err := migrate.Load(migrations.FS)
+	assert.NoError(err)
+
+	applied, err := m.Up()
+	assert.NoError(err)
+	assert.Equal(all, applied)
+
+	applied, err = m.Up()
+	assert.NoError(err)
+	assert.Empty(applied)
+
+	statuses, err := m.Status()
+	assert.NoError(err)
+	for _, s := range statuses {
+		assert.NotNil(s.AppliedAt)
+	}
+
+	rolledBack, err := m.Down(1)
+	assert.NoError(err)
+	assert.Equal([]migrate.Migration{all[len(all)-1]}, rolledBack)
+
+	statuses, err = m.Status()
+	assert.NoError(err)
+	assert.Nil(statuses[len(statuses)-1].AppliedAt)
+
+	rolledBack, err = m.Down(len(all))
+	assert.NoError(err)
+	assert.Len(rolledBack, len(all)-1)
+}
@@ -1,7 +1,6 @@
 package pgsql
 
 import (
-	"log"
 	"time"
 
 	"github.com/go-pg/pg"
@@ -9,14 +8,62 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// Options represents database connection options. Zero values fall back to go-pg defaults.
+type Options struct {
+	// LogQueries logs failed queries and ones running at least SlowQueryThreshold through Logger
+	LogQueries bool
+
+	// SlowQueryThreshold is the minimum duration of logged queries. Zero logs all queries.
+	SlowQueryThreshold time.Duration
+
+	// Logger logs queries
+	Logger Logger
+
+	// Timeout is network read and write timeout
+	Timeout time.Duration
+
+	// PoolSize is the maximum number of open connections
+	PoolSize int
+
+	// MinIdleConns is the number of idle connections kept open
+	MinIdleConns int
+
+	// IdleTimeout is the time after which idle connections are closed
+	IdleTimeout time.Duration
+
+	// MaxConnAge is the time after which connections are closed and replaced
+	MaxConnAge time.Duration
+
+	// PoolTimeout is how long to wait for a free connection when all of them are busy
+	PoolTimeout time.Duration
+
+	// StatementTimeout aborts statements running longer than it
+	StatementTimeout time.Duration
+}
+
 // New creates new database connection to a postgres database
 // Function panics if it can't connect to database
-func New(psn string, logQueries bool, timeout int) (*pg.DB, error) {
+func New(psn string, o Options) (*pg.DB, error) {
 	u, err := pg.ParseURL(psn)
 	if err != nil {
 		return nil, err
 	}
 
+	u.ReadTimeout = o.Timeout
+	u.WriteTimeout = o.Timeout
+	u.PoolSize = o.PoolSize
+	u.MinIdleConns = o.MinIdleConns
+	u.IdleTimeout = o.IdleTimeout
+	u.MaxConnAge = o.MaxConnAge
+	u.PoolTimeout = o.PoolTimeout
+
+	if o.StatementTimeout > 0 {
+		u.OnConnect = func(conn *pg.DB) error {
+			_, err := conn.Exec("SET statement_timeout = ?", o.StatementTimeout.Nanoseconds()/int64(time.Millisecond))
+			return err
+		}
+	}
+
 	db := pg.Connect(u)
 
 	_, err = db.Exec("SELECT 1")
@@ -24,16 +71,42 @@ func New(psn string, logQueries bool, timeout int) (*pg.DB, error) {
 		return nil, err
 	}
 
-	if timeout > 0 {
-		db.WithTimeout(time.Second * time.Duration(timeout))
-	}
-
-	if logQueries {
-		db.OnQueryProcessed(func(event *pg.QueryProcessedEvent) {
-			query, _ := event.FormattedQuery()
-			log.Printf("%s | %s", time.Since(event.StartTime), query)
-		})
+	if o.LogQueries && o.Logger != nil {
+		db.OnQueryProcessed(queryHook(o.Logger, o.SlowQueryThreshold))
 	}
 
 	return db, nil
 }
+
+// Stats represents connection pool statistics
+type Stats struct {
+	// Hits is the number of times a free connection was found in the pool
+	Hits uint32 `json:"hits"`
+
+	// Misses is the number of times a new connection had to be opened
+	Misses uint32 `json:"misses"`
+
+	// Timeouts is the number of times waiting for a free connection timed out, signaling pool exhaustion
+	Timeouts uint32 `json:"timeouts"`
+
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+
+	// PoolSize is the maximum number of open connections
+	PoolSize int `json:"pool_size"`
+}
+
+// PoolStats returns db's connection pool statistics
+func PoolStats(db *pg.DB) Stats {
+	s := db.PoolStats()
+	return Stats{
+		Hits:       s.Hits,
+		Misses:     s.Misses,
+		Timeouts:   s.Timeouts,
+		TotalConns: s.TotalConns,
+		IdleConns:  s.IdleConns,
+		StaleConns: s.StaleConns,
+		PoolSize:   db.Options().PoolSize,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/ribice/chisk/model"
 
@@ -31,13 +32,13 @@ func TestNew(t *testing.T) {
 	hostPort := resource.GetHostPort("5432/tcp")
 	dbConnStr := fmt.Sprintf("postgres://postgres:secret@%s/test?sslmode=disable", hostPort)
 
-	_, err = pgsql.New("invalidPSN", false, 0)
+	_, err = pgsql.New("invalidPSN", pgsql.Options{})
 	assert.Error(err)
 
 	fmt.Println(dbConnStr)
 
 	if err = pool.Retry(func() error {
-		db, err = pgsql.New(dbConnStr, true, 1)
+		db, err = pgsql.New(dbConnStr, pgsql.Options{LogQueries: true, Timeout: time.Second, PoolSize: 5, StatementTimeout: time.Second})
 		return err
 	}); err != nil {
 		t.Fatalf("Could not connect to docker: %s", err)
@@ -47,4 +48,17 @@ func TestNew(t *testing.T) {
 
 	err = db.Select(&chisk.AuthUser{})
 	assert.Error(err)
+
+	_, err = db.Exec("SELECT pg_sleep(2)")
+	assert.Error(err, "statement timeout is applied")
+
+	stats := pgsql.PoolStats(db)
+	assert.Equal(5, stats.PoolSize)
+	assert.NotZero(stats.TotalConns)
+}
+
+func TestPoolStats(t *testing.T) {
+	db := pg.Connect(&pg.Options{PoolSize: 3})
+	defer db.Close()
+	assert.Equal(t, pgsql.Stats{PoolSize: 3}, pgsql.PoolStats(db))
 }
@@ -0,0 +1,124 @@
+package pgsql
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// queryHook returns query processed hook logging queries running at least slow long, as well as failed ones.
+// Literals are redacted from logged queries, as they commonly hold personal data.
+func queryHook(log Logger, slow time.Duration) func(*pg.QueryProcessedEvent) {
+	return func(ev *pg.QueryProcessedEvent) {
+		d := time.Since(ev.StartTime)
+		failed := ev.Error != nil && ev.Error != pg.ErrNoRows
+		if d < slow && !failed {
+			return
+		}
+
+		query, err := ev.FormattedQuery()
+		if err != nil {
+			query, _ = ev.UnformattedQuery()
+		}
+
+		params := map[string]interface{}{
+			"query":       Redact(query),
+			"duration_ms": float64(d) / float64(time.Millisecond),
+			"caller":      fmt.Sprintf("%s:%d", filepath.Base(ev.File), ev.Line),
+			"func":        ev.Func,
+		}
+		if ev.Result != nil {
+			params["rows_affected"] = ev.Result.RowsAffected()
+		}
+		if ev.Attempt > 0 {
+			params["attempt"] = ev.Attempt
+		}
+
+		msg := "Query processed"
+		switch {
+		case failed:
+			msg = "Query failed"
+		case slow > 0:
+			msg = "Slow query"
+		}
+
+		log.Log(queryContext(ev), "postgres", msg, errOrNil(failed, ev.Error), params)
+	}
+}
+
+// queryContext returns context the query was run with, using Conn or RunInTx
+func queryContext(ev *pg.QueryProcessedEvent) context.Context {
+	if db, ok := ev.DB.(interface{ Context() context.Context }); ok {
+		return db.Context()
+	}
+	return context.Background()
+}
+
+func errOrNil(failed bool, err error) error {
+	if failed {
+		return err
+	}
+	return nil
+}
+
+// Redact replaces string and numeric literals in query with ?, keeping its structure
+func Redact(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// Skip to the closing quote, treating doubled quotes as escaped ones
+			for i++; i < len(query); i++ {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+		case c == '"':
+			// Quoted identifiers are kept as they are
+			j := strings.IndexByte(query[i+1:], '"')
+			if j < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+j+2])
+			i += j + 1
+		case isDigit(c) && (i == 0 || !isIdent(query[i-1])):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		case isIdent(c):
+			// Copy identifiers whole, so digits within them are not redacted
+			j := i
+			for j+1 < len(query) && isIdent(query[j+1]) {
+				j++
+			}
+			b.WriteString(query[i : j+1])
+			i = j
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
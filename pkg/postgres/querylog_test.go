@@ -0,0 +1,48 @@
+package pgsql_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "Strings and numbers",
+			query: `SELECT * FROM users WHERE email = 'john@example.org' AND role = 3 LIMIT 10`,
+			want:  `SELECT * FROM users WHERE email = ? AND role = ? LIMIT ?`,
+		},
+		{
+			name:  "Escaped quotes",
+			query: `INSERT INTO users (last_name) VALUES ('O''Brien')`,
+			want:  `INSERT INTO users (last_name) VALUES (?)`,
+		},
+		{
+			name:  "Quoted identifiers and digits in names",
+			query: `SELECT "user"."id", t1.col2 FROM "users" AS "user" WHERE "user".deleted_at IS NULL AND score > 1.5`,
+			want:  `SELECT "user"."id", t1.col2 FROM "users" AS "user" WHERE "user".deleted_at IS NULL AND score > ?`,
+		},
+		{
+			name:  "Placeholders",
+			query: `UPDATE sessions SET value = $1 WHERE key = $2`,
+			want:  `UPDATE sessions SET value = $1 WHERE key = $2`,
+		},
+		{
+			name:  "Unterminated string",
+			query: `SELECT 'secret`,
+			want:  `SELECT ?`,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pgsql.Redact(tt.query))
+		})
+	}
+}
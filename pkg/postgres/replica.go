@@ -0,0 +1,140 @@
+package pgsql
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+type primaryKey struct{}
+
+// ForcePrimary returns context routing reads to the primary, e.g. to read own writes
+// without waiting for them to be replicated
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// NewCluster creates cluster routing writes to primary and reads to replicas.
+// Without replicas, all queries go to the primary.
+func NewCluster(primary *pg.DB, replicas ...*pg.DB) *Cluster {
+	c := &Cluster{primary: primary}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db, healthy: 1})
+	}
+	return c
+}
+
+// Cluster represents primary database and its read replicas
+type Cluster struct {
+	primary  *pg.DB
+	replicas []*replica
+	next     uint32
+}
+
+type replica struct {
+	db      *pg.DB
+	healthy int32
+}
+
+// Primary returns the primary database, e.g. for TxRunner
+func (c *Cluster) Primary() *pg.DB {
+	return c.primary
+}
+
+// Write returns connection for writes, which is the transaction carried in ctx or the primary
+func (c *Cluster) Write(ctx context.Context) orm.DB {
+	return Conn(ctx, c.primary)
+}
+
+// Read returns connection for reads. Reads are routed round-robin to healthy replicas,
+// unless ctx carries a transaction or was created by ForcePrimary.
+func (c *Cluster) Read(ctx context.Context) orm.DB {
+	if _, ok := ctx.Value(txKey{}).(*txState); ok {
+		return Conn(ctx, c.primary)
+	}
+	if force, _ := ctx.Value(primaryKey{}).(bool); force {
+		return c.primary.WithContext(ctx)
+	}
+
+	n := len(c.replicas)
+	start := atomic.AddUint32(&c.next, 1)
+	for i := 0; i < n; i++ {
+		r := c.replicas[(int(start)+i)%n]
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			return r.db.WithContext(ctx)
+		}
+	}
+
+	return c.primary.WithContext(ctx)
+}
+
+// CheckHealth pings replicas concurrently, taking ones that fail or don't respond within timeout
+// out of rotation until they respond again. Returns the number of healthy replicas.
+func (c *Cluster) CheckHealth(ctx context.Context, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		i  int
+		ok bool
+	}
+	// Buffered so that pings still running past the deadline don't block
+	results := make(chan result, len(c.replicas))
+	for i, r := range c.replicas {
+		go func(i int, db *pg.DB) {
+			_, err := db.WithContext(ctx).WithTimeout(timeout).Exec("SELECT 1")
+			results <- result{i: i, ok: err == nil}
+		}(i, r.db)
+	}
+
+	ok := make([]bool, len(c.replicas))
+wait:
+	for range c.replicas {
+		select {
+		case res := <-results:
+			ok[res.i] = res.ok
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	var healthy int
+	for i, r := range c.replicas {
+		if !ok[i] {
+			atomic.StoreInt32(&r.healthy, 0)
+			continue
+		}
+		atomic.StoreInt32(&r.healthy, 1)
+		healthy++
+	}
+	return healthy
+}
+
+// RunHealthChecks checks replicas' health every interval, until ctx is cancelled.
+// Each check must complete within the interval, so that checks don't overlap.
+func (c *Cluster) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.CheckHealth(ctx, interval)
+		}
+	}
+}
+
+// Close closes primary and replica connections
+func (c *Cluster) Close() error {
+	err := c.primary.Close()
+	for _, r := range c.replicas {
+		if rerr := r.db.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package pgsql_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+func addr(db orm.DB) string {
+	return db.(*pg.DB).Options().Addr
+}
+
+func TestCluster(t *testing.T) {
+	assert := assert.New(t)
+
+	// Connections are established lazily, and nothing listens on these ports, so replicas fail health checks
+	primary := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	c := pgsql.NewCluster(primary,
+		pg.Connect(&pg.Options{Addr: "localhost:2"}),
+		pg.Connect(&pg.Options{Addr: "localhost:3"}),
+	)
+	defer c.Close()
+
+	ctx := context.Background()
+	assert.Equal("localhost:1", addr(c.Write(ctx)))
+
+	first, second := addr(c.Read(ctx)), addr(c.Read(ctx))
+	assert.ElementsMatch([]string{"localhost:2", "localhost:3"}, []string{first, second}, "reads are round-robin")
+	assert.Equal(first, addr(c.Read(ctx)))
+
+	assert.Equal("localhost:1", addr(c.Read(pgsql.ForcePrimary(ctx))))
+
+	assert.Equal(0, c.CheckHealth(ctx, time.Second))
+	assert.Equal("localhost:1", addr(c.Read(ctx)), "reads fall back to primary without healthy replicas")
+
+	assert.Equal(primary, c.Primary())
+}
+
+func TestClusterWithoutReplicas(t *testing.T) {
+	c := pgsql.NewCluster(pg.Connect(&pg.Options{Addr: "localhost:1"}))
+	defer c.Close()
+	assert.Equal(t, "localhost:1", addr(c.Read(context.Background())))
+}
+
+func TestCheckHealthTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	// Replicas accept connections but never respond, so pings hang until the deadline
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			cn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer cn.Close()
+		}
+	}()
+
+	var replicas []*pg.DB
+	for i := 0; i < 3; i++ {
+		replicas = append(replicas, pg.Connect(&pg.Options{Addr: ln.Addr().String()}))
+	}
+	c := pgsql.NewCluster(pg.Connect(&pg.Options{Addr: "localhost:1"}), replicas...)
+	defer c.Close()
+
+	const timeout = 200 * time.Millisecond
+	start := time.Now()
+	assert.Equal(0, c.CheckHealth(context.Background(), timeout))
+	assert.True(time.Since(start) < 2*timeout, "replicas are pinged concurrently within the deadline, took %s", time.Since(start))
+	assert.Equal("localhost:1", addr(c.Read(context.Background())), "unresponsive replicas are out of rotation")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	assert.Equal(0, c.CheckHealth(ctx, time.Minute))
+	assert.True(time.Since(start) < time.Second, "check stops when ctx is cancelled")
+}
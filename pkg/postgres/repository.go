@@ -0,0 +1,85 @@
+package pgsql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// NewRepository creates repository for models embedding chisk.Base.
+// Reads go to replicas, writes to the primary or the transaction carried in context.
+func NewRepository(db *Cluster) *Repository {
+	return &Repository{db: db}
+}
+
+// Repository provides CRUD and listing of soft deletable models
+type Repository struct {
+	db *Cluster
+}
+
+// Get loads model by ID, returning pg.ErrNoRows if it does not exist or is soft deleted
+func (r *Repository) Get(ctx context.Context, model interface{}, id string) error {
+	return Model(r.db.Read(ctx), model).Where("?TableAlias.id = ?", id).Select()
+}
+
+// List loads models matching q into slice pointed to by models, e.g. *[]chisk.User
+func (r *Repository) List(ctx context.Context, models interface{}, q ListQuery) (*Page, error) {
+	query := Model(r.db.Read(ctx), models).Apply(q.Apply)
+
+	page := &Page{}
+	var err error
+	if q.Cursor == nil {
+		page.Total, err = query.SelectAndCount()
+	} else {
+		err = query.Select()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply fetches one row more than the limit, signaling the next page
+	v := reflect.ValueOf(models).Elem()
+	if v.Len() <= q.Limit {
+		return page, nil
+	}
+	v.Set(v.Slice(0, q.Limit))
+
+	last := reflect.Indirect(v.Index(q.Limit - 1))
+	table := orm.GetTable(last.Type())
+	sortField, ok := table.FieldsMap[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%s has no %s column", table.TypeName, q.Sort)
+	}
+	page.NextCursor = Cursor{
+		Sort:  q.Sort,
+		Value: sortField.Value(last).Interface(),
+		ID:    table.FieldsMap["id"].Value(last).Interface().(string),
+	}.Encode()
+
+	return page, nil
+}
+
+// Create inserts model
+func (r *Repository) Create(ctx context.Context, model interface{}) error {
+	return r.db.Write(ctx).Insert(model)
+}
+
+// Update updates all columns of model, returning pg.ErrNoRows if it does not exist or is soft deleted
+func (r *Repository) Update(ctx context.Context, model interface{}) error {
+	res, err := r.db.Write(ctx).Model(model).WherePK().Apply(ExcludeDeleted.Apply).Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// Delete soft deletes model
+func (r *Repository) Delete(ctx context.Context, model SoftDeletable) error {
+	return SoftDelete(r.db.Write(ctx), model)
+}
@@ -0,0 +1,137 @@
+package pgsql
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// Scope determines whether queries include soft deleted rows
+type Scope int
+
+const (
+	// ExcludeDeleted scopes queries to rows that are not soft deleted
+	ExcludeDeleted Scope = iota
+
+	// WithDeleted includes soft deleted rows
+	WithDeleted
+
+	// OnlyDeleted scopes queries to soft deleted rows
+	OnlyDeleted
+)
+
+// Apply adds scope's condition to the query. Use it with orm.Query.Apply.
+func (s Scope) Apply(q *orm.Query) (*orm.Query, error) {
+	switch s {
+	case ExcludeDeleted:
+		return q.Where("?TableAlias.deleted_at IS NULL"), nil
+	case OnlyDeleted:
+		return q.Where("?TableAlias.deleted_at IS NOT NULL"), nil
+	default:
+		return q, nil
+	}
+}
+
+// Model creates query for model, excluding soft deleted rows unless a different scope is given
+func Model(db orm.DB, model interface{}, scope ...Scope) *orm.Query {
+	s := ExcludeDeleted
+	if len(scope) > 0 {
+		s = scope[0]
+	}
+	return db.Model(model).Apply(s.Apply)
+}
+
+// SoftDeletable is implemented by models which can be soft deleted, e.g. ones embedding chisk.Base
+type SoftDeletable interface {
+	SetDeletedAt(*time.Time)
+}
+
+// SoftDelete marks model's row as deleted instead of deleting it.
+// Returns pg.ErrNoRows if the row does not exist or is already deleted.
+func SoftDelete(db orm.DB, model SoftDeletable) error {
+	now := time.Now()
+	model.SetDeletedAt(&now)
+	return setDeletedAt(db, model, ExcludeDeleted)
+}
+
+// Restore restores soft deleted model's row.
+// Returns pg.ErrNoRows if the row does not exist or is not deleted.
+func Restore(db orm.DB, model SoftDeletable) error {
+	model.SetDeletedAt(nil)
+	return setDeletedAt(db, model, OnlyDeleted)
+}
+
+func setDeletedAt(db orm.DB, model SoftDeletable, s Scope) error {
+	res, err := db.Model(model).Column("deleted_at", "updated_at").WherePK().Apply(s.Apply).Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// Purge permanently deletes rows of model's table soft deleted before given time
+func Purge(db orm.DB, model interface{}, before time.Time) (int, error) {
+	res, err := db.Model(model).Where("?TableAlias.deleted_at < ?", before).Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(context.Context, string, string, error, map[string]interface{})
+}
+
+// NewPurger creates job purging rows soft deleted longer than retention ago from models' tables.
+// Models are pointers to structs, e.g. (*chisk.User)(nil).
+func NewPurger(db orm.DB, retention time.Duration, log Logger, models ...interface{}) *Purger {
+	return &Purger{db: db, retention: retention, log: log, models: models}
+}
+
+// Purger periodically purges soft deleted rows
+type Purger struct {
+	db        orm.DB
+	retention time.Duration
+	log       Logger
+	models    []interface{}
+}
+
+// Purge purges soft deleted rows past retention once
+func (p *Purger) Purge(ctx context.Context) error {
+	before := time.Now().Add(-p.retention)
+	for _, m := range p.models {
+		n, err := Purge(p.db, m, before)
+		if err != nil {
+			p.log.Log(ctx, "purger", "Error purging soft deleted rows", err, nil)
+			return err
+		}
+		if n > 0 {
+			p.log.Log(ctx, "purger", "Purged soft deleted rows", nil, map[string]interface{}{
+				"table": string(orm.GetTable(reflect.TypeOf(m).Elem()).Name),
+				"rows":  n,
+			})
+		}
+	}
+	return nil
+}
+
+// Run purges soft deleted rows every interval, until ctx is cancelled
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		p.Purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
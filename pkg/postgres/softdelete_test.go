@@ -0,0 +1,155 @@
+package pgsql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/ory/dockertest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+func TestModel(t *testing.T) {
+	cases := []struct {
+		name      string
+		scope     []pgsql.Scope
+		wantWhere string
+	}{
+		{
+			name:      "Excludes deleted by default",
+			wantWhere: `WHERE ("user".deleted_at IS NULL)`,
+		},
+		{
+			name:  "With deleted",
+			scope: []pgsql.Scope{pgsql.WithDeleted},
+		},
+		{
+			name:      "Only deleted",
+			scope:     []pgsql.Scope{pgsql.OnlyDeleted},
+			wantWhere: `WHERE ("user".deleted_at IS NOT NULL)`,
+		},
+	}
+
+	// Connection is established lazily, so no database is needed to build queries
+	db := pg.Connect(&pg.Options{})
+	defer db.Close()
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var users []chisk.User
+			b, err := pgsql.Model(db, &users, tt.scope...).AppendQuery(nil)
+			assert.NoError(t, err)
+			if tt.wantWhere == "" {
+				assert.NotContains(t, string(b), "WHERE")
+				return
+			}
+			assert.Contains(t, string(b), tt.wantWhere)
+		})
+	}
+}
+
+func TestSetDeletedAt(t *testing.T) {
+	u := &chisk.User{}
+	var m pgsql.SoftDeletable = u
+
+	now := time.Now()
+	m.SetDeletedAt(&now)
+	assert.Equal(t, &now, u.DeletedAt)
+
+	m.SetDeletedAt(nil)
+	assert.Nil(t, u.DeletedAt)
+}
+
+type note struct {
+	chisk.Base
+	Title string
+}
+
+type purgeLog struct {
+	msgs   []string
+	params []map[string]interface{}
+}
+
+func (l *purgeLog) Log(_ context.Context, _, msg string, _ error, params map[string]interface{}) {
+	l.msgs = append(l.msgs, msg)
+	l.params = append(l.params, params)
+}
+
+func TestSoftDelete(t *testing.T) {
+	assert := assert.New(t)
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.Run("postgres", "9.6.5-alpine", []string{"POSTGRES_PASSWORD=secret", "POSTGRES_DB=test"})
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+	defer pool.Purge(resource)
+
+	var db *pg.DB
+	dbConnStr := fmt.Sprintf("postgres://postgres:secret@%s/test?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	if err = pool.Retry(func() error {
+		db, err = pgsql.New(dbConnStr, pgsql.Options{})
+		return err
+	}); err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE notes (id TEXT PRIMARY KEY, created_at TIMESTAMPTZ, updated_at TIMESTAMPTZ,
+		deleted_at TIMESTAMPTZ, title TEXT)`)
+	assert.NoError(err)
+
+	a, b, c := &note{Title: "a"}, &note{Title: "b"}, &note{Title: "c"}
+	for _, n := range []*note{a, b, c} {
+		assert.NoError(db.Insert(n))
+	}
+
+	titles := func(scope pgsql.Scope) []string {
+		var notes []note
+		assert.NoError(pgsql.Model(db, &notes, scope).Order("title").Select())
+		var got []string
+		for _, n := range notes {
+			got = append(got, n.Title)
+		}
+		return got
+	}
+
+	assert.NoError(pgsql.SoftDelete(db, a))
+	assert.NotNil(a.DeletedAt)
+	assert.Equal([]string{"b", "c"}, titles(pgsql.ExcludeDeleted), "soft deleted row is hidden by default")
+	assert.Equal([]string{"a"}, titles(pgsql.OnlyDeleted))
+	assert.Equal([]string{"a", "b", "c"}, titles(pgsql.WithDeleted))
+	assert.Equal(pg.ErrNoRows, pgsql.SoftDelete(db, a), "deleted row is not deleted again")
+
+	assert.NoError(pgsql.Restore(db, a))
+	assert.Nil(a.DeletedAt)
+	assert.Equal([]string{"a", "b", "c"}, titles(pgsql.ExcludeDeleted), "restored row is visible again")
+	assert.Equal(pg.ErrNoRows, pgsql.Restore(db, a), "row that is not deleted is not restored")
+
+	assert.NoError(pgsql.SoftDelete(db, a))
+	assert.NoError(pgsql.SoftDelete(db, b))
+	_, err = db.Exec("UPDATE notes SET deleted_at = ? WHERE id = ?", time.Now().Add(-48*time.Hour), b.ID)
+	assert.NoError(err)
+
+	log := &purgeLog{}
+	p := pgsql.NewPurger(db, 24*time.Hour, log, (*note)(nil))
+	assert.NoError(p.Purge(context.Background()))
+	assert.Equal([]string{"a", "c"}, titles(pgsql.WithDeleted), "only rows deleted before retention are purged")
+	assert.Equal([]string{"Purged soft deleted rows"}, log.msgs)
+	assert.Equal([]map[string]interface{}{{"table": "notes", "rows": 1}}, log.params)
+
+	assert.NoError(p.Purge(context.Background()))
+	assert.Len(log.msgs, 1, "nothing is logged when no rows are purged")
+
+	n, err := pgsql.Purge(db, (*note)(nil), time.Now())
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.Equal([]string{"c"}, titles(pgsql.WithDeleted), "rows that are not deleted are never purged")
+}
@@ -0,0 +1,108 @@
+package pgsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-pg/pg/orm"
+)
+
+// Serialization failures and deadlocks are safe to retry, as postgres rolls back the whole transaction
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// DefaultTxRetries is the number of times a transaction is retried after a serialization failure
+const DefaultTxRetries = 3
+
+type txKey struct{}
+
+// txState is the transaction carried in context, along with its savepoint nesting depth
+type txState struct {
+	tx    *pg.Tx
+	depth int
+}
+
+// NewTxRunner creates transaction runner retrying serialization failures given number of times
+func NewTxRunner(db *pg.DB, retries int) *TxRunner {
+	return &TxRunner{db: db, retries: retries}
+}
+
+// TxRunner runs functions in database transactions
+type TxRunner struct {
+	db      *pg.DB
+	retries int
+}
+
+// RunInTx runs fn in a transaction, committing it if fn returns nil and rolling it back otherwise.
+// The transaction is propagated through fn's context, so repositories using Conn join it.
+// Calls nested in an existing transaction run in a savepoint, rolling back only their own changes.
+// Transactions failing with serialization or deadlock errors are retried, so fn must be safe to rerun.
+func (r *TxRunner) RunInTx(ctx context.Context, fn func(context.Context) error) error {
+	if s, ok := ctx.Value(txKey{}).(*txState); ok {
+		return savepoint(ctx, s, fn)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := r.db.WithContext(ctx).RunInTransaction(func(tx *pg.Tx) error {
+			return fn(context.WithValue(ctx, txKey{}, &txState{tx: tx}))
+		})
+		if err == nil || !Retryable(err) || attempt >= r.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+		}
+	}
+}
+
+// savepoint runs fn in a savepoint of the transaction in s
+func savepoint(ctx context.Context, s *txState, fn func(context.Context) error) (err error) {
+	name := fmt.Sprintf("sp_%d", s.depth+1)
+	if _, err := s.tx.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = s.tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, &txState{tx: s.tx, depth: s.depth + 1})); err != nil {
+		_, _ = s.tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+		return err
+	}
+
+	_, err = s.tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
+
+// Conn returns the transaction carried in ctx by RunInTx, or db bound to ctx if there is none
+func Conn(ctx context.Context, db orm.DB) orm.DB {
+	if s, ok := ctx.Value(txKey{}).(*txState); ok {
+		return s.tx
+	}
+	if pdb, ok := db.(*pg.DB); ok {
+		return pdb.WithContext(ctx)
+	}
+	return db
+}
+
+// Retryable reports whether err is a serialization failure or deadlock, after which the transaction can be retried
+func Retryable(err error) bool {
+	var pgErr pg.Error
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	code := pgErr.Field('C')
+	return code == serializationFailure || code == deadlockDetected
+}
@@ -0,0 +1,126 @@
+package pgsql_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-pg/pg"
+	"github.com/ory/dockertest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+type pgError string
+
+func (e pgError) Error() string { return "pg error " + string(e) }
+
+func (e pgError) Field(f byte) string {
+	if f == 'C' {
+		return string(e)
+	}
+	return ""
+}
+
+func (e pgError) IntegrityViolation() bool { return false }
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Nil"},
+		{name: "Generic error", err: errors.New("generic")},
+		{name: "Unique violation", err: pgError("23505")},
+		{name: "Serialization failure", err: pgError("40001"), want: true},
+		{name: "Deadlock", err: pgError("40P01"), want: true},
+		{name: "Wrapped", err: fmt.Errorf("registering: %w", pgError("40001")), want: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pgsql.Retryable(tt.err))
+		})
+	}
+}
+
+func TestConn(t *testing.T) {
+	db := pg.Connect(&pg.Options{})
+	defer db.Close()
+
+	ctx := context.WithValue(context.Background(), ctxKey("k"), "v")
+	conn, ok := pgsql.Conn(ctx, db).(*pg.DB)
+	assert.True(t, ok)
+	assert.Equal(t, ctx, conn.Context())
+}
+
+type ctxKey string
+
+func TestRunInTx(t *testing.T) {
+	assert := assert.New(t)
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.Run("postgres", "9.6.5-alpine", []string{"POSTGRES_PASSWORD=secret", "POSTGRES_DB=test"})
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+	defer pool.Purge(resource)
+
+	var db *pg.DB
+	dbConnStr := fmt.Sprintf("postgres://postgres:secret@%s/test?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	if err = pool.Retry(func() error {
+		db, err = pgsql.New(dbConnStr, pgsql.Options{})
+		return err
+	}); err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	_, err = db.Exec("CREATE TABLE items (name TEXT PRIMARY KEY)")
+	assert.NoError(err)
+
+	insert := func(c context.Context, name string) error {
+		_, err := pgsql.Conn(c, db).Exec("INSERT INTO items VALUES (?)", name)
+		return err
+	}
+	count := func() int {
+		n, err := db.Model().Table("items").Count()
+		assert.NoError(err)
+		return n
+	}
+
+	txr := pgsql.NewTxRunner(db, 2)
+	ctx := context.Background()
+
+	err = txr.RunInTx(ctx, func(c context.Context) error {
+		assert.NoError(insert(c, "a"))
+		return insert(c, "a")
+	})
+	assert.Error(err)
+	assert.Equal(0, count(), "failed transaction is rolled back")
+
+	err = txr.RunInTx(ctx, func(c context.Context) error {
+		assert.NoError(insert(c, "a"))
+		assert.Error(txr.RunInTx(c, func(c context.Context) error {
+			assert.NoError(insert(c, "b"))
+			return insert(c, "a")
+		}))
+		return txr.RunInTx(c, func(c context.Context) error {
+			return insert(c, "c")
+		})
+	})
+	assert.NoError(err)
+	assert.Equal(2, count(), "failed savepoint is rolled back alone")
+
+	var attempts int
+	err = txr.RunInTx(ctx, func(c context.Context) error {
+		attempts++
+		return pgError("40001")
+	})
+	assert.Equal(pgError("40001"), err)
+	assert.Equal(3, attempts)
+}
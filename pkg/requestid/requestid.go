@@ -0,0 +1,80 @@
+// Package requestid generates and propagates request IDs, correlating logs of a single request
+// across services.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ribice/chisk/pkg/uid"
+)
+
+// Header is the header request IDs are read from, echoed in and forwarded with
+const Header = "X-Request-ID"
+
+// maxLen limits accepted request IDs, which end up in every log line
+const maxLen = 128
+
+type ctxKey struct{}
+
+// NewContext returns context carrying request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns request ID carried in ctx, or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Middleware stores request ID in request context and echoes it in response header.
+// IDs sent by clients or upstream services are kept if valid, otherwise new ones are generated.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = uid.New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// valid reports whether id is non-empty and consists of safe characters only, preventing log injection
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// Transport forwards request ID carried in outgoing requests' context. Base defaults to http.DefaultTransport.
+//
+//	client := &http.Client{Transport: &requestid.Transport{}}
+//	req = req.WithContext(r.Context())
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if id := FromContext(r.Context()); id != "" && r.Header.Get(Header) == "" {
+		// RoundTrippers must not modify the request, so headers are set on a copy
+		r = r.Clone(r.Context())
+		r.Header.Set(Header, id)
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,74 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/requestid"
+)
+
+func TestMiddleware(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		wantKept bool
+	}{
+		{name: "Missing header"},
+		{name: "Valid header", header: "upstream-id_1.2:3", wantKept: true},
+		{name: "Unsafe characters", header: "id\nfake log line"},
+		{name: "Too long", header: strings.Repeat("a", 200)},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+			h := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = requestid.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestid.Header, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			assert.NotEmpty(t, ctxID)
+			assert.Equal(t, ctxID, rec.Header().Get(requestid.Header))
+			if tt.wantKept {
+				assert.Equal(t, tt.header, ctxID)
+			} else {
+				assert.Len(t, ctxID, 20)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(requestid.Header))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &requestid.Transport{}}
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err := client.Do(req.WithContext(requestid.NewContext(context.Background(), "reqid")))
+	assert.NoError(t, err)
+
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set(requestid.Header, "explicit")
+	_, err = client.Do(req.WithContext(requestid.NewContext(context.Background(), "reqid")))
+	assert.NoError(t, err)
+
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	_, err = client.Do(req)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"reqid", "explicit", ""}, got)
+}
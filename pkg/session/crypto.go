@@ -0,0 +1,72 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// keyPrefix prefixes store keys derived from jwt tokens
+const keyPrefix = "session:"
+
+var errMalformedPayload = errors.New("malformed session payload")
+
+// crypter derives store keys from jwt tokens and encrypts session payloads,
+// so that read access to the store does not expose usable tokens or user data
+type crypter struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// newCrypter derives token hashing and payload encryption keys from secret
+func newCrypter(secret string) *crypter {
+	// AES-256 and GCM constructors only fail on invalid key sizes, and derived keys are always 32 bytes long
+	block, _ := aes.NewCipher(derive(secret, "session encryption"))
+	aead, _ := cipher.NewGCM(block)
+	return &crypter{
+		hashKey: derive(secret, "session key"),
+		aead:    aead,
+	}
+}
+
+func derive(secret, label string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(label))
+	return h.Sum(nil)
+}
+
+// key returns store key for jwt token
+func (c *crypter) key(token string) string {
+	h := hmac.New(sha256.New, c.hashKey)
+	h.Write([]byte(token))
+	return keyPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// isKey reports whether k is a derived store key, as opposed to a raw jwt token used by legacy sessions
+func isKey(k string) bool {
+	return strings.HasPrefix(k, keyPrefix)
+}
+
+// seal encrypts payload, prefixing it with a random nonce
+func (c *crypter) seal(b []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(b)+c.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, b, nil), nil
+}
+
+// open decrypts payload encrypted by seal
+func (c *crypter) open(b []byte) ([]byte, error) {
+	ns := c.aead.NonceSize()
+	if len(b) < ns {
+		return nil, errMalformedPayload
+	}
+	return c.aead.Open(nil, b[:ns], b[ns:], nil)
+}
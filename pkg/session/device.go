@@ -0,0 +1,57 @@
+package session
+
+import "strings"
+
+// Browsers and platforms are matched in order, as user agents commonly
+// mention several of them (e.g. Chrome's user agent contains Safari).
+var (
+	browsers = []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"Edge/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+	}
+
+	platforms = []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "Chrome OS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// deviceName returns friendly device name, e.g. "Chrome on macOS", parsed from user agent
+func deviceName(userAgent string) string {
+	var browser, platform string
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
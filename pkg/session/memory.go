@@ -0,0 +1,195 @@
+package session
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryStore creates new in-memory session store.
+// Expired items are evicted every cleanup interval, if it is greater than zero.
+func NewMemoryStore(cleanup time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		items: make(map[string]memItem),
+		sets:  make(map[string]*memSet),
+		done:  make(chan struct{}),
+	}
+	if cleanup > 0 {
+		go m.evict(cleanup)
+	}
+	return m
+}
+
+// MemoryStore represents in-memory session store
+type MemoryStore struct {
+	mu    sync.RWMutex
+	items map[string]memItem
+	sets  map[string]*memSet
+	done  chan struct{}
+	once  sync.Once
+}
+
+type memItem struct {
+	val       []byte
+	expiresAt time.Time
+}
+
+func (i memItem) expired(now time.Time) bool {
+	return !now.Before(i.expiresAt)
+}
+
+type memSet struct {
+	members   map[string]struct{}
+	expiresAt time.Time
+}
+
+func (s *memSet) expired(now time.Time) bool {
+	return !now.Before(s.expiresAt)
+}
+
+// Get returns value stored under key
+func (m *MemoryStore) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i, ok := m.items[key]
+	if !ok || i.expired(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return i.val, nil
+}
+
+// Set stores value under key, expiring after given duration
+func (m *MemoryStore) Set(key string, val []byte, exp time.Duration) error {
+	m.mu.Lock()
+	m.items[key] = memItem{val: val, expiresAt: time.Now().Add(exp)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Update replaces value of an existing key, preserving its expiration
+func (m *MemoryStore) Update(key string, val []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.items[key]
+	if !ok || i.expired(time.Now()) {
+		return ErrNotFound
+	}
+	i.val = val
+	m.items[key] = i
+	return nil
+}
+
+// Refresh replaces value of an existing key, expiring it after given duration
+func (m *MemoryStore) Refresh(key string, val []byte, exp time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	i, ok := m.items[key]
+	if !ok || i.expired(now) {
+		return ErrNotFound
+	}
+	m.items[key] = memItem{val: val, expiresAt: now.Add(exp)}
+	return nil
+}
+
+// Count returns number of unexpired values stored under keys starting with prefix
+func (m *MemoryStore) Count(prefix string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now, n := time.Now(), 0
+	for k, i := range m.items {
+		if strings.HasPrefix(k, prefix) && !i.expired(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Delete deletes values and sets stored under keys
+func (m *MemoryStore) Delete(keys ...string) error {
+	m.mu.Lock()
+	for _, k := range keys {
+		delete(m.items, k)
+		delete(m.sets, k)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// AddMember adds member to the set stored under key, extending the set's expiration to at least exp
+func (m *MemoryStore) AddMember(key, member string, exp time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	set, ok := m.sets[key]
+	if !ok || set.expired(now) {
+		set = &memSet{members: make(map[string]struct{})}
+		m.sets[key] = set
+	}
+	set.members[member] = struct{}{}
+	if expiresAt := now.Add(exp); expiresAt.After(set.expiresAt) {
+		set.expiresAt = expiresAt
+	}
+	return nil
+}
+
+// Members returns members of the set stored under key
+func (m *MemoryStore) Members(key string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	set, ok := m.sets[key]
+	if !ok || set.expired(time.Now()) {
+		return []string{}, nil
+	}
+	members := make([]string, 0, len(set.members))
+	for member := range set.members {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// RemoveMembers removes members from the set stored under key
+func (m *MemoryStore) RemoveMembers(key string, members ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set, ok := m.sets[key]
+	if !ok {
+		return nil
+	}
+	for _, member := range members {
+		delete(set.members, member)
+	}
+	if len(set.members) == 0 {
+		delete(m.sets, key)
+	}
+	return nil
+}
+
+// Close stops evicting expired items
+func (m *MemoryStore) Close() {
+	m.once.Do(func() { close(m.done) })
+}
+
+func (m *MemoryStore) evict(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-t.C:
+			m.mu.Lock()
+			for k, i := range m.items {
+				if i.expired(now) {
+					delete(m.items, k)
+				}
+			}
+			for k, set := range m.sets {
+				if set.expired(now) {
+					delete(m.sets, k)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package session_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ribice/chisk/pkg/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	assert := assert.New(t)
+
+	m := session.NewMemoryStore(10 * time.Millisecond)
+	defer m.Close()
+
+	assert.NoError(m.Set("key", []byte("value"), time.Hour))
+	assert.NoError(m.Set("short", []byte("value"), 5*time.Millisecond))
+
+	val, err := m.Get("key")
+	assert.NoError(err)
+	assert.Equal([]byte("value"), val)
+
+	assert.NoError(m.Update("key", []byte("updated")))
+	val, err = m.Get("key")
+	assert.NoError(err)
+	assert.Equal([]byte("updated"), val)
+
+	assert.NoError(m.Refresh("key", []byte("refreshed"), time.Hour))
+	assert.Equal(session.ErrNotFound, m.Refresh("missing", []byte("value"), time.Hour))
+
+	time.Sleep(30 * time.Millisecond)
+
+	_, err = m.Get("short")
+	assert.Equal(session.ErrNotFound, err)
+	assert.Equal(session.ErrNotFound, m.Update("short", []byte("value")))
+
+	val, err = m.Get("key")
+	assert.NoError(err)
+	assert.Equal([]byte("refreshed"), val)
+
+	assert.NoError(m.Delete("key", "missing"))
+	_, err = m.Get("key")
+	assert.Equal(session.ErrNotFound, err)
+}
+
+func TestMemoryStoreSets(t *testing.T) {
+	assert := assert.New(t)
+
+	m := session.NewMemoryStore(0)
+
+	assert.NoError(m.AddMember("set", "a", time.Hour))
+	assert.NoError(m.AddMember("set", "b", time.Hour))
+	assert.NoError(m.AddMember("set", "a", time.Hour))
+
+	members, err := m.Members("set")
+	assert.NoError(err)
+	assert.ElementsMatch([]string{"a", "b"}, members)
+
+	assert.NoError(m.RemoveMembers("set", "a"))
+	members, err = m.Members("set")
+	assert.NoError(err)
+	assert.Equal([]string{"b"}, members)
+
+	assert.NoError(m.Delete("set"))
+	members, err = m.Members("set")
+	assert.NoError(err)
+	assert.Empty(members)
+
+	assert.NoError(m.AddMember("expiring", "a", 50*time.Millisecond))
+	assert.NoError(m.AddMember("expiring", "b", time.Millisecond))
+	time.Sleep(10 * time.Millisecond)
+	members, err = m.Members("expiring")
+	assert.NoError(err)
+	assert.ElementsMatch([]string{"a", "b"}, members, "shorter expiration does not shorten the set's")
+
+	time.Sleep(50 * time.Millisecond)
+	members, err = m.Members("expiring")
+	assert.NoError(err)
+	assert.Empty(members)
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+)
+
+// NewPGStore creates new postgres backed session store.
+// Its tables are created by the create_sessions migration.
+func NewPGStore(db *pg.DB) *PGStore {
+	return &PGStore{db: db}
+}
+
+// PGStore represents postgres session store
+type PGStore struct {
+	db *pg.DB
+}
+
+// Get returns value stored under key
+func (s *PGStore) Get(key string) ([]byte, error) {
+	var val []byte
+	_, err := s.db.QueryOne(pg.Scan(&val), "SELECT value FROM sessions WHERE key = ? AND expires_at > now()", key)
+	if err == pg.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return val, err
+}
+
+// Set stores value under key, expiring after given duration
+func (s *PGStore) Set(key string, val []byte, exp time.Duration) error {
+	_, err := s.db.Exec(`INSERT INTO sessions (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		key, val, time.Now().Add(exp))
+	return err
+}
+
+// Update replaces value of an existing key, preserving its expiration
+func (s *PGStore) Update(key string, val []byte) error {
+	res, err := s.db.Exec("UPDATE sessions SET value = ? WHERE key = ? AND expires_at > now()", val, key)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Refresh replaces value of an existing key, expiring it after given duration
+func (s *PGStore) Refresh(key string, val []byte, exp time.Duration) error {
+	res, err := s.db.Exec("UPDATE sessions SET value = ?, expires_at = ? WHERE key = ? AND expires_at > now()",
+		val, time.Now().Add(exp), key)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Count returns number of unexpired values stored under keys starting with prefix
+func (s *PGStore) Count(prefix string) (int, error) {
+	var n int
+	_, err := s.db.QueryOne(pg.Scan(&n), `SELECT count(*) FROM sessions WHERE key LIKE ? AND expires_at > now()`,
+		likeEscaper.Replace(prefix)+"%")
+	return n, err
+}
+
+// likeEscaper escapes LIKE wildcards
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Delete deletes values and sets stored under keys
+func (s *PGStore) Delete(keys ...string) error {
+	return s.db.RunInTransaction(func(tx *pg.Tx) error {
+		if _, err := tx.Exec("DELETE FROM sessions WHERE key IN (?)", pg.In(keys)); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM session_index WHERE key IN (?)", pg.In(keys))
+		return err
+	})
+}
+
+// AddMember adds member to the set stored under key.
+// Index rows do not expire, they are removed along with expired sessions by DeleteExpired.
+func (s *PGStore) AddMember(key, member string, _ time.Duration) error {
+	_, err := s.db.Exec("INSERT INTO session_index (key, member) VALUES (?, ?) ON CONFLICT DO NOTHING", key, member)
+	return err
+}
+
+// Members returns members of the set stored under key
+func (s *PGStore) Members(key string) ([]string, error) {
+	var members []string
+	_, err := s.db.Query(&members, "SELECT member FROM session_index WHERE key = ?", key)
+	return members, err
+}
+
+// RemoveMembers removes members from the set stored under key
+func (s *PGStore) RemoveMembers(key string, members ...string) error {
+	_, err := s.db.Exec("DELETE FROM session_index WHERE key = ? AND member IN (?)", key, pg.In(members))
+	return err
+}
+
+// DeleteExpired removes expired sessions, along with index rows of sessions that no longer exist
+func (s *PGStore) DeleteExpired() error {
+	return s.db.RunInTransaction(func(tx *pg.Tx) error {
+		if _, err := tx.Exec("DELETE FROM sessions WHERE expires_at <= now()"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM session_index i WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.key = i.member)")
+		return err
+	})
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
+}
+
+// RunCleanup deletes expired sessions every interval, until ctx is cancelled
+func (s *PGStore) RunCleanup(ctx context.Context, interval time.Duration, log Logger) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.DeleteExpired(); err != nil {
+				log.Log(ctx, "session", "Error deleting expired sessions", err, nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package session_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/stretchr/testify/assert"
+	dockertest "gopkg.in/ory-am/dockertest.v3"
+
+	"github.com/ribice/chisk/internal/migrations"
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/postgres"
+	"github.com/ribice/chisk/pkg/session"
+)
+
+func TestPGStore(t *testing.T) {
+	assert := assert.New(t)
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.Run("postgres", "9.6.5-alpine", []string{"POSTGRES_PASSWORD=secret", "POSTGRES_DB=test"})
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+	defer pool.Purge(resource)
+
+	var db *pg.DB
+	dbConnStr := fmt.Sprintf("postgres://postgres:secret@%s/test?sslmode=disable", resource.GetHostPort("5432/tcp"))
+	if err = pool.Retry(func() error {
+		db, err = pgsql.New(dbConnStr, pgsql.Options{})
+		return err
+	}); err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	schema, err := migrations.FS.ReadFile("0002_create_sessions.up.sql")
+	assert.NoError(err)
+	_, err = db.Exec(string(schema))
+	assert.NoError(err)
+
+	s := session.NewPGStore(db)
+
+	_, err = s.Get("key")
+	assert.Equal(session.ErrNotFound, err)
+	assert.Equal(session.ErrNotFound, s.Update("key", []byte("value")))
+
+	assert.NoError(s.Set("key", []byte("value"), time.Minute))
+	val, err := s.Get("key")
+	assert.NoError(err)
+	assert.Equal([]byte("value"), val)
+
+	assert.NoError(s.Update("key", []byte("updated")))
+	assert.NoError(s.Refresh("key", []byte("refreshed"), time.Hour))
+	val, err = s.Get("key")
+	assert.NoError(err)
+	assert.Equal([]byte("refreshed"), val)
+
+	assert.NoError(s.Set("expired", []byte("value"), -time.Second))
+	_, err = s.Get("expired")
+	assert.Equal(session.ErrNotFound, err, "expired session is not returned")
+	assert.Equal(session.ErrNotFound, s.Update("expired", []byte("updated")))
+	assert.Equal(session.ErrNotFound, s.Refresh("expired", []byte("refreshed"), time.Hour))
+
+	assert.NoError(s.Set("session:key", []byte("value"), time.Minute))
+	assert.NoError(s.Set("session:expired", []byte("value"), -time.Second))
+	n, err := s.Count("session:")
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.NoError(s.Delete("session:key", "session:expired"))
+
+	assert.NoError(s.AddMember("set", "key", time.Hour))
+	assert.NoError(s.AddMember("set", "expired", time.Hour))
+	assert.NoError(s.DeleteExpired())
+	rows, err := db.Model().Table("sessions").Count()
+	assert.NoError(err)
+	assert.Equal(1, rows, "expired session is deleted")
+	members, err := s.Members("set")
+	assert.NoError(err)
+	assert.Equal([]string{"key"}, members, "index row of deleted session is deleted")
+
+	assert.NoError(s.Delete("key"))
+	_, err = s.Get("key")
+	assert.Equal(session.ErrNotFound, err)
+
+	svc := session.New(s, opts)
+	john := &chisk.User{Base: chisk.Base{ID: "john"}, Token: "john1"}
+	assert.NoError(svc.Put(john, "127.0.0.1", ""))
+	john.Token = "john2"
+	assert.NoError(svc.Put(john, "127.0.0.1", ""))
+	assert.NoError(svc.Put(&chisk.User{Base: chisk.Base{ID: "jane"}, Token: "jane1"}, "127.0.0.1", ""))
+
+	u, err := svc.Get(context.Background(), "john1")
+	assert.NoError(err)
+	assert.Equal("john", u.ID)
+
+	assert.NoError(svc.RevokeAllForUser("john"))
+	for _, token := range []string{"john1", "john2"} {
+		_, err = svc.Get(context.Background(), token)
+		assert.Equal(session.ErrNotFound, err, "%s is revoked", token)
+	}
+	sessions, err := svc.ListByUser("john")
+	assert.NoError(err)
+	assert.Empty(sessions)
+
+	u, err = svc.Get(context.Background(), "jane1")
+	assert.NoError(err, "sessions of other users are kept")
+	assert.Equal("jane", u.ID)
+}
@@ -0,0 +1,139 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// NewRedisStore creates new redis backed session store
+func NewRedisStore(c *redis.Client) *RedisStore {
+	return &RedisStore{client: c}
+}
+
+// RedisStore represents redis session store
+type RedisStore struct {
+	client *redis.Client
+	hook   func(*redis.Client)
+}
+
+// Instrument registers hook instrumenting clients bound to request context by WithContext,
+// e.g. to trace their commands
+func (s *RedisStore) Instrument(hook func(*redis.Client)) {
+	s.hook = hook
+}
+
+// WithContext returns store whose commands carry ctx
+func (s *RedisStore) WithContext(ctx context.Context) Store {
+	c := s.client.WithContext(ctx)
+	if s.hook != nil {
+		s.hook(c)
+	}
+	return &RedisStore{client: c, hook: s.hook}
+}
+
+// Get returns value stored under key
+func (s *RedisStore) Get(key string) ([]byte, error) {
+	val, err := s.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return val, err
+}
+
+// Set stores value under key, expiring after given duration
+func (s *RedisStore) Set(key string, val []byte, exp time.Duration) error {
+	return s.client.Set(key, val, exp).Err()
+}
+
+// updateScript replaces value of an existing key, keeping its TTL
+var updateScript = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+	return false
+end
+if ttl == -1 then
+	return redis.call("SET", KEYS[1], ARGV[1])
+end
+return redis.call("SET", KEYS[1], ARGV[1], "PX", ttl)
+`)
+
+// Update replaces value of an existing key, preserving its expiration
+func (s *RedisStore) Update(key string, val []byte) error {
+	err := updateScript.Run(s.client, []string{key}, val).Err()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Count returns number of values stored under keys starting with prefix, scanning the keyspace
+func (s *RedisStore) Count(prefix string) (int, error) {
+	var (
+		cursor uint64
+		n      int
+	)
+	match := redisGlobEscaper.Replace(prefix) + "*"
+	for {
+		keys, next, err := s.client.Scan(cursor, match, 1000).Result()
+		if err != nil {
+			return 0, err
+		}
+		n += len(keys)
+		if next == 0 {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+// redisGlobEscaper escapes glob-style pattern characters
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// Refresh replaces value of an existing key, expiring it after given duration
+func (s *RedisStore) Refresh(key string, val []byte, exp time.Duration) error {
+	ok, err := s.client.SetXX(key, val, exp).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete deletes values stored under keys
+func (s *RedisStore) Delete(keys ...string) error {
+	return s.client.Del(keys...).Err()
+}
+
+// addMemberScript adds member to a set, extending its TTL unless it already expires later
+var addMemberScript = redis.NewScript(`
+redis.call("SADD", KEYS[1], ARGV[1])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// AddMember adds member to the set stored under key, extending the set's expiration to at least exp
+func (s *RedisStore) AddMember(key, member string, exp time.Duration) error {
+	return addMemberScript.Run(s.client, []string{key}, member, int64(exp/time.Millisecond)).Err()
+}
+
+// Members returns members of the set stored under key
+func (s *RedisStore) Members(key string) ([]string, error) {
+	return s.client.SMembers(key).Result()
+}
+
+// RemoveMembers removes members from the set stored under key
+func (s *RedisStore) RemoveMembers(key string, members ...string) error {
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	return s.client.SRem(key, args...).Err()
+}
@@ -0,0 +1,85 @@
+package session_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ribice/chisk/pkg/redis"
+	"github.com/ribice/chisk/pkg/session"
+	"github.com/stretchr/testify/assert"
+	dockertest "gopkg.in/ory-am/dockertest.v3"
+)
+
+func TestRedisStore(t *testing.T) {
+	assert := assert.New(t)
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	resource, err := pool.Run("redis", "4.0.11", nil)
+	if err != nil {
+		t.Fatalf("Could not start resource: %s", err)
+	}
+
+	port, _ := strconv.Atoi(resource.GetPort("6379/tcp"))
+
+	rclient, err := redis.New("localhost", "", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := session.NewRedisStore(rclient)
+
+	_, err = s.Get("usertoken")
+	assert.Equal(session.ErrNotFound, err)
+	assert.Equal(session.ErrNotFound, s.Update("usertoken", []byte("value")))
+
+	assert.NoError(s.Set("usertoken", []byte("value"), 1*time.Minute))
+
+	val, err := s.Get("usertoken")
+	assert.NoError(err)
+	assert.Equal([]byte("value"), val)
+
+	assert.NoError(s.Update("usertoken", []byte("updated")))
+	val, err = s.Get("usertoken")
+	assert.NoError(err)
+	assert.Equal([]byte("updated"), val)
+
+	ttl, err := rclient.PTTL("usertoken").Result()
+	assert.NoError(err)
+	assert.True(ttl > 0)
+
+	assert.NoError(s.Refresh("usertoken", []byte("refreshed"), 1*time.Hour))
+	ttl, err = rclient.PTTL("usertoken").Result()
+	assert.NoError(err)
+	assert.True(ttl > 1*time.Minute)
+	assert.Equal(session.ErrNotFound, s.Refresh("missing", []byte("value"), 1*time.Hour))
+
+	assert.NoError(s.Delete("usertoken"))
+	_, err = s.Get("usertoken")
+	assert.Equal(session.ErrNotFound, err)
+
+	assert.NoError(s.AddMember("set", "a", time.Hour))
+	assert.NoError(s.AddMember("set", "b", time.Minute))
+	assert.NoError(s.RemoveMembers("set", "a"))
+	members, err := s.Members("set")
+	assert.NoError(err)
+	assert.Equal([]string{"b"}, members)
+	ttl, err = rclient.PTTL("set").Result()
+	assert.NoError(err)
+	assert.True(ttl > 59*time.Minute, "shorter expiration does not shorten the set's")
+
+	for _, key := range []string{"session:a", "session:b", "session:*"} {
+		assert.NoError(s.Set(key, []byte("value"), time.Minute))
+	}
+	n, err := s.Count("session:")
+	assert.NoError(err)
+	assert.Equal(3, n)
+	n, err = s.Count("session:*")
+	assert.NoError(err)
+	assert.Equal(1, n, "glob characters in prefix are matched literally")
+
+	pool.Purge(resource)
+}
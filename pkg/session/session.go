@@ -1,44 +1,195 @@
 package session
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/ribice/chisk/model"
-
-	"github.com/go-redis/redis"
 )
 
-// New creates new redis session store
-func New(c *redis.Client, d int) *Service {
-	return &Service{client: c, duration: time.Duration(d) * time.Hour}
+// ErrNotFound is returned by stores when session does not exist or has expired
+var ErrNotFound = errors.New("session not found")
+
+// Store represents session storage backend
+type Store interface {
+	// Get returns value stored under key
+	Get(key string) ([]byte, error)
+	// Set stores value under key, expiring after given duration
+	Set(key string, val []byte, exp time.Duration) error
+	// Update replaces value of an existing key, preserving its expiration
+	Update(key string, val []byte) error
+	// Refresh replaces value of an existing key, expiring it after given duration
+	Refresh(key string, val []byte, exp time.Duration) error
+	// Delete deletes values stored under keys
+	Delete(keys ...string) error
+	// AddMember adds member to the set stored under key, extending the set's expiration to at least exp
+	AddMember(key, member string, exp time.Duration) error
+	// Members returns members of the set stored under key
+	Members(key string) ([]string, error)
+	// RemoveMembers removes members from the set stored under key
+	RemoveMembers(key string, members ...string) error
+}
+
+// ContextStore is implemented by stores able to bind calls to request context, e.g. for tracing
+type ContextStore interface {
+	Store
+	// WithContext returns store whose calls carry ctx
+	WithContext(ctx context.Context) Store
+}
+
+// CountingStore is implemented by stores able to count their live keys, e.g. to report active sessions
+type CountingStore interface {
+	Store
+	// Count returns number of unexpired values stored under keys starting with prefix
+	Count(prefix string) (int, error)
 }
 
-// Service represents in memory session store
+// ErrCountNotSupported is returned by Active when the store can't count its keys
+var ErrCountNotSupported = errors.New("session store does not support counting")
+
+// Options holds session service settings
+type Options struct {
+	// Secret is used to derive store keys from jwt tokens and to encrypt session payloads
+	Secret string
+
+	// MigrateLegacy moves sessions stored under raw jwt tokens to derived keys on first access
+	MigrateLegacy bool
+
+	// Lifetime is the absolute session lifetime, counted from its creation
+	Lifetime time.Duration
+
+	// IdleTimeout expires sessions without activity. Zero disables idle expiration.
+	IdleTimeout time.Duration
+
+	// AdminIdleTimeout overrides IdleTimeout for admin roles, if set
+	AdminIdleTimeout time.Duration
+
+	// TouchInterval throttles activity writes to one per interval.
+	// Idle expiration is refreshed on those writes only, so it should be well below IdleTimeout.
+	TouchInterval time.Duration
+
+	// Events counts created, deleted and revoked sessions, if set
+	Events Counter
+}
+
+// Counter counts events partitioned by label values
+type Counter interface {
+	Add(v float64, labelValues ...string)
+}
+
+// New creates new session service backed by given store
+func New(s Store, o Options) *Service {
+	return &Service{store: s, opts: o, crypt: newCrypter(o.Secret)}
+}
+
+// Service represents session service
 type Service struct {
-	client   *redis.Client
-	duration time.Duration
+	store Store
+	opts  Options
+	crypt *crypter
+}
+
+// Session represents an active user session
+type Session struct {
+	ID        string          `json:"id"`
+	User      *chisk.AuthUser `json:"-"`
+	Device    string          `json:"device"`
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	CreatedAt time.Time       `json:"created_at"`
+	LastSeen  time.Time       `json:"last_seen"`
+	Current   bool            `json:"current"`
 }
 
 type item struct {
-	User *chisk.AuthUser
+	User      *chisk.AuthUser
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+	Device    string
 }
 
-func (i *item) encode() string {
+func (i *item) setClient(ip, userAgent string) {
+	i.IP = ip
+	i.UserAgent = userAgent
+	i.Device = deviceName(userAgent)
+}
+
+func (i *item) encode() []byte {
 	b, _ := json.Marshal(i)
-	return string(b)
+	return b
+}
+
+func (i *item) session(key string) *Session {
+	return &Session{
+		ID:        key,
+		User:      i.User,
+		Device:    i.Device,
+		IP:        i.IP,
+		UserAgent: i.UserAgent,
+		CreatedAt: i.CreatedAt,
+		LastSeen:  i.LastSeen,
+	}
 }
 
-func (*Service) decodeItem(str string) (*item, error) {
+func (*Service) decodeItem(b []byte) (*item, error) {
 	var i item
-	err := json.Unmarshal([]byte(str), &i)
+	err := json.Unmarshal(b, &i)
 	return &i, err
 }
 
-// Get tries to fetch existing session for given jwt token
-func (s *Service) Get(token string) (*chisk.AuthUser, error) {
-	val, err := s.client.Get(token).Result()
+// userKey returns key of the set holding user's session keys
+func userKey(id string) string {
+	return "user_sessions:" + id
+}
+
+// ID returns ID of the session belonging to given jwt token
+func (s *Service) ID(token string) string {
+	return s.crypt.key(token)
+}
+
+// encode encodes and encrypts session item
+func (s *Service) encode(i *item) ([]byte, error) {
+	return s.crypt.seal(i.encode())
+}
+
+// get fetches session item stored under key
+func (s *Service) get(key string) (*item, error) {
+	val, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.crypt.open(val)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := s.decodeItem(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.checkExpiry(i)
+}
+
+// load fetches session item belonging to jwt token, migrating legacy sessions if enabled
+func (s *Service) load(token string) (*item, error) {
+	i, err := s.get(s.crypt.key(token))
+	if err == ErrNotFound && s.opts.MigrateLegacy {
+		return s.migrate(token)
+	}
+	return i, err
+}
+
+// migrate moves unencrypted session stored under raw jwt token to its derived key
+func (s *Service) migrate(token string) (*item, error) {
+	val, err := s.store.Get(token)
 	if err != nil {
 		return nil, err
 	}
@@ -48,21 +199,291 @@ func (s *Service) Get(token string) (*chisk.AuthUser, error) {
 		return nil, err
 	}
 
+	if i, err = s.checkExpiry(i); err != nil {
+		return nil, err
+	}
+
+	if err := s.set(token, i, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if i.User != nil {
+		if err := s.store.RemoveMembers(userKey(i.User.ID), token); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, s.store.Delete(token)
+}
+
+// set stores session item belonging to jwt token and adds it to user's index
+func (s *Service) set(token string, i *item, now time.Time) error {
+	val, err := s.encode(i)
+	if err != nil {
+		return err
+	}
+
+	key := s.crypt.key(token)
+	ttl := s.ttl(i, now)
+	if err := s.store.Set(key, val, ttl); err != nil {
+		return err
+	}
+
+	if i.User == nil {
+		return nil
+	}
+
+	// The index outlives any session it holds, so that it expires once all of them did
+	exp := s.opts.Lifetime
+	if ttl > exp {
+		exp = ttl
+	}
+	return s.store.AddMember(userKey(i.User.ID), key, exp)
+}
+
+func (s *Service) checkExpiry(i *item) (*item, error) {
+	now := time.Now()
+	if i.ExpiresAt.IsZero() {
+		// Sessions created before absolute expiration was introduced
+		i.ExpiresAt = now.Add(s.opts.Lifetime)
+	}
+
+	if !now.Before(i.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	return i, nil
+}
+
+// idleTimeout returns idle timeout applying to given user
+func (s *Service) idleTimeout(u *chisk.AuthUser) time.Duration {
+	if s.opts.AdminIdleTimeout > 0 && u != nil && u.Role > 0 && u.Role <= chisk.AdminRole {
+		return s.opts.AdminIdleTimeout
+	}
+	return s.opts.IdleTimeout
+}
+
+// ttl returns duration after which session expires if there is no further activity
+func (s *Service) ttl(i *item, now time.Time) time.Duration {
+	ttl := i.ExpiresAt.Sub(now)
+	if idle := s.idleTimeout(i.User); idle > 0 && idle < ttl {
+		return idle
+	}
+	return ttl
+}
+
+// count counts n session events
+func (s *Service) count(event string, n int) {
+	if s.opts.Events != nil && n > 0 {
+		s.opts.Events.Add(float64(n), event)
+	}
+}
+
+// withContext returns copy of service whose store calls carry ctx, if the store supports it
+func (s *Service) withContext(ctx context.Context) *Service {
+	cs, ok := s.store.(ContextStore)
+	if !ok {
+		return s
+	}
+	c := *s
+	c.store = cs.WithContext(ctx)
+	return &c
+}
+
+// Active returns number of sessions that have not expired.
+// Legacy sessions stored under raw jwt tokens are not counted.
+func (s *Service) Active() (int, error) {
+	cs, ok := s.store.(CountingStore)
+	if !ok {
+		return 0, ErrCountNotSupported
+	}
+	return cs.Count(keyPrefix)
+}
+
+// Get tries to fetch existing session for given jwt token
+func (s *Service) Get(ctx context.Context, token string) (*chisk.AuthUser, error) {
+	i, err := s.withContext(ctx).load(token)
+	if err != nil {
+		return nil, err
+	}
+
 	return i.User, nil
 }
 
-// Put saves new user session based on key
-func (s *Service) Put(user *chisk.User) error {
+// Put saves new user session based on key, recording the client it was created from
+func (s *Service) Put(user *chisk.User, ip, userAgent string) error {
+	now := time.Now()
 	i := item{
-		User: user.AuthUser(),
+		User:      user.AuthUser(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.opts.Lifetime),
+		LastSeen:  now,
+	}
+	i.setClient(ip, userAgent)
+
+	if err := s.set(user.Token, &i, now); err != nil {
+		return err
 	}
 
-	return s.client.Set(user.Token, i.encode(), s.duration).Err()
+	s.count("created", 1)
+	return nil
 }
 
 // Delete deletes session based on jwt token key
 func (s *Service) Delete(token string) error {
-	return s.client.Del(token).Err()
+	key := s.crypt.key(token)
+	i, err := s.load(token)
+	if err == nil && i.User != nil {
+		if err := s.store.RemoveMembers(userKey(i.User.ID), key); err != nil {
+			return err
+		}
+	}
+
+	if err := s.store.Delete(key); err != nil {
+		return err
+	}
+
+	s.count("deleted", 1)
+	return nil
+}
+
+// ListByUser returns all active sessions of a user.
+// Keys of expired sessions are removed from user's index.
+func (s *Service) ListByUser(userID string) ([]*Session, error) {
+	keys, err := s.store.Members(userKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sessions []*Session
+		stale    []string
+	)
+
+	for _, k := range keys {
+		var (
+			i   *item
+			err error
+		)
+
+		switch {
+		case isKey(k):
+			i, err = s.get(k)
+		case s.opts.MigrateLegacy:
+			// Legacy index members are raw jwt tokens
+			i, err = s.migrate(k)
+			k = s.crypt.key(k)
+		default:
+			err = ErrNotFound
+		}
+
+		if err == ErrNotFound {
+			stale = append(stale, k)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, i.session(k))
+	}
+
+	if len(stale) > 0 {
+		if err := s.store.RemoveMembers(userKey(userID), stale...); err != nil {
+			return nil, err
+		}
+	}
+
+	return sessions, nil
+}
+
+// RevokeAllForUser deletes all sessions of a user
+func (s *Service) RevokeAllForUser(userID string) error {
+	keys, err := s.store.Members(userKey(userID))
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(append(keys, userKey(userID))...); err != nil {
+		return err
+	}
+
+	s.count("revoked", len(keys))
+	return nil
+}
+
+// RevokeOthers deletes all sessions of a user, except the one belonging to given jwt token
+func (s *Service) RevokeOthers(userID, token string) error {
+	keys, err := s.store.Members(userKey(userID))
+	if err != nil {
+		return err
+	}
+
+	current := s.crypt.key(token)
+
+	var others []string
+	for _, k := range keys {
+		if k != current && k != token {
+			others = append(others, k)
+		}
+	}
+
+	if len(others) == 0 {
+		return nil
+	}
+
+	if err := s.store.Delete(others...); err != nil {
+		return err
+	}
+
+	if err := s.store.RemoveMembers(userKey(userID), others...); err != nil {
+		return err
+	}
+
+	s.count("revoked", len(others))
+	return nil
+}
+
+// GetAndTouch fetches existing session for given jwt token and records activity on it like Touch,
+// loading the session once. If only recording the activity fails, the user is returned along with the error.
+func (s *Service) GetAndTouch(ctx context.Context, token, ip, userAgent string) (*chisk.AuthUser, error) {
+	s = s.withContext(ctx)
+	i, err := s.load(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.User, s.touch(token, i, ip, userAgent)
+}
+
+// Touch records activity on session belonging to given jwt token, extending its idle timeout.
+// Writes are throttled to one per touch interval, unless the client's IP or user agent changed.
+func (s *Service) Touch(ctx context.Context, token, ip, userAgent string) error {
+	s = s.withContext(ctx)
+	i, err := s.load(token)
+	if err != nil {
+		return err
+	}
+
+	return s.touch(token, i, ip, userAgent)
+}
+
+// touch records activity on loaded session item belonging to jwt token
+func (s *Service) touch(token string, i *item, ip, userAgent string) error {
+	now := time.Now()
+	if now.Sub(i.LastSeen) < s.opts.TouchInterval && i.IP == ip && i.UserAgent == userAgent {
+		return nil
+	}
+
+	i.LastSeen = now
+	i.setClient(ip, userAgent)
+
+	val, err := s.encode(i)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Refresh(s.crypt.key(token), val, s.ttl(i, now))
 }
 
 // Update updates current user's session
@@ -72,9 +493,17 @@ func (s *Service) Update(user *chisk.User) error {
 		return fmt.Errorf("missing token")
 	}
 
-	i := item{
-		User: user.AuthUser(),
+	i, err := s.load(user.Token)
+	if err != nil {
+		return err
+	}
+
+	i.User = user.AuthUser()
+
+	val, err := s.encode(i)
+	if err != nil {
+		return err
 	}
 
-	return s.client.GetSet(user.Token, i.encode()).Err()
+	return s.store.Update(s.crypt.key(user.Token), val)
 }
@@ -1,33 +1,30 @@
 package session_test
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"strconv"
 	"testing"
 	"time"
 
 	"github.com/ribice/chisk/pkg/session"
 
 	"github.com/ribice/chisk/model"
-	"github.com/ribice/chisk/pkg/redis"
 	"github.com/stretchr/testify/assert"
-	dockertest "gopkg.in/ory-am/dockertest.v3"
 )
 
 type item struct {
 	User *chisk.AuthUser
 }
 
-func (i item) encode() string {
+func (i item) encode() []byte {
 	b, _ := json.Marshal(i)
-	return string(b)
+	return b
 }
 
-func decodeItem(str string) (*item, error) {
-	var i item
-	err := json.Unmarshal([]byte(str), &i)
-	return &i, err
+var opts = session.Options{
+	Secret:        "sessionsecret",
+	Lifetime:      time.Hour,
+	TouchInterval: time.Minute,
 }
 
 func TestGet(t *testing.T) {
@@ -36,27 +33,37 @@ func TestGet(t *testing.T) {
 	cases := []struct {
 		name     string
 		getToken string
-		setToken string
-		setData  interface{}
+		setKey   string
+		setData  []byte
+		migrate  bool
 		wantErr  bool
 		wantData *chisk.AuthUser
 	}{
 		{
 			name:     "Different set and get token",
-			setToken: "token1",
+			setKey:   "session:token1",
 			getToken: "token2",
 			wantErr:  true,
 		},
 		{
 			name:     "Invalid item",
-			setToken: "token1",
+			setKey:   session.New(nil, opts).ID("token1"),
 			getToken: "token1",
-			setData:  "simpleString",
+			setData:  []byte("simpleString"),
 			wantErr:  true,
 		},
 		{
-			name:     "Success",
-			setToken: "token1",
+			name:     "Legacy session without migration",
+			setKey:   "token1",
+			getToken: "token1",
+			setData: item{
+				User: &chisk.AuthUser{ID: "userid"},
+			}.encode(),
+			wantErr: true,
+		},
+		{
+			name:     "Legacy session migration",
+			setKey:   "token1",
 			getToken: "token1",
 			setData: item{
 				User: &chisk.AuthUser{
@@ -65,6 +72,7 @@ func TestGet(t *testing.T) {
 					DisplayName: "johndoe",
 				},
 			}.encode(),
+			migrate: true,
 			wantData: &chisk.AuthUser{
 				ID:          "userid",
 				Email:       "johndoe@mail.com",
@@ -73,174 +81,476 @@ func TestGet(t *testing.T) {
 		},
 	}
 
-	pool, err := dockertest.NewPool("")
-	if err != nil {
-		t.Fatalf("Could not connect to docker: %s", err)
-	}
-
-	resource, err := pool.Run("redis", "4.0.11", nil)
-	if err != nil {
-		log.Fatalf("Could not start resource: %s", err)
-	}
-
-	port, _ := strconv.Atoi(resource.GetPort("6379/tcp"))
-
-	rclient, err := redis.New("localhost", "", port)
-	if err != nil {
-		t.Fatal(err)
-	}
-	sessSvc := session.New(rclient, 1)
-
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
+			store := session.NewMemoryStore(0)
+			o := opts
+			o.MigrateLegacy = tt.migrate
+			sessSvc := session.New(store, o)
 
-			err := rclient.Set(tt.setToken, tt.setData, 1*time.Hour).Err()
+			err := store.Set(tt.setKey, tt.setData, 1*time.Hour)
 			assert.NoError(err)
 
-			au, err := sessSvc.Get(tt.getToken)
+			au, err := sessSvc.Get(context.Background(), tt.getToken)
 			assert.Equal(tt.wantErr, err != nil)
 			assert.Equal(tt.wantData, au)
 
 		})
 	}
-
-	pool.Purge(resource)
-
 }
 
-func TestPut(t *testing.T) {
+func TestMigrateLegacy(t *testing.T) {
 	assert := assert.New(t)
 
-	pool, err := dockertest.NewPool("")
-	if err != nil {
-		t.Fatalf("Could not connect to docker: %s", err)
-	}
+	store := session.NewMemoryStore(0)
+	o := opts
+	o.MigrateLegacy = true
+	sessSvc := session.New(store, o)
 
-	resource, err := pool.Run("redis", "4.0.11", nil)
-	if err != nil {
-		log.Fatalf("Could not start resource: %s", err)
-	}
+	legacy := item{User: &chisk.AuthUser{ID: "userid"}}.encode()
+	assert.NoError(store.Set("token1", legacy, time.Hour))
+	assert.NoError(store.Set("token2", legacy, time.Hour))
+	assert.NoError(store.AddMember("user_sessions:userid", "token1", time.Hour))
+	assert.NoError(store.AddMember("user_sessions:userid", "token2", time.Hour))
 
-	port, _ := strconv.Atoi(resource.GetPort("6379/tcp"))
+	_, err := sessSvc.Get(context.Background(), "token1")
+	assert.NoError(err)
 
-	rclient, err := redis.New("localhost", "", port)
-	if err != nil {
-		t.Fatal(err)
-	}
+	// Legacy key is removed once migrated
+	_, err = store.Get("token1")
+	assert.Equal(session.ErrNotFound, err)
+
+	// Remaining legacy sessions are migrated when listed
+	sessions, err := sessSvc.ListByUser("userid")
+	assert.NoError(err)
+	assert.ElementsMatch([]string{sessSvc.ID("token1"), sessSvc.ID("token2")}, sessionIDs(sessions))
 
-	sessSvc := session.New(rclient, 1)
+	members, err := store.Members("user_sessions:userid")
+	assert.NoError(err)
+	assert.ElementsMatch([]string{sessSvc.ID("token1"), sessSvc.ID("token2")}, members)
+}
 
-	err = sessSvc.Put(&chisk.User{
+func TestPut(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+
+	err := sessSvc.Put(&chisk.User{
 		Base: chisk.Base{
 			ID: "userid",
 		},
 		Email:       "johndoe@mail.com",
 		DisplayName: "johndoe",
 		Token:       "usertoken",
-	})
+	}, "127.0.0.1", "curl/7.54.0")
 	assert.NoError(err)
 
-	strUser, err := rclient.Get("usertoken").Result()
-	assert.NoError(err)
+	// Neither the token nor user data is stored in plain text
+	_, err = store.Get("usertoken")
+	assert.Equal(session.ErrNotFound, err)
 
-	item, err := decodeItem(strUser)
+	b, err := store.Get(sessSvc.ID("usertoken"))
 	assert.NoError(err)
+	assert.NotContains(string(b), "johndoe")
 
+	au, err := sessSvc.Get(context.Background(), "usertoken")
+	assert.NoError(err)
 	assert.Equal(&chisk.AuthUser{
 		ID:          "userid",
 		Email:       "johndoe@mail.com",
 		DisplayName: "johndoe",
-	}, item.User)
+	}, au)
+
+	// Keys depend on the secret
+	o := opts
+	o.Secret = "othersecret"
+	assert.NotEqual(sessSvc.ID("usertoken"), session.New(store, o).ID("usertoken"))
+	_, err = session.New(store, o).Get(context.Background(), "usertoken")
+	assert.Equal(session.ErrNotFound, err)
+}
+
+func TestDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
 
-	pool.Purge(resource)
+	putSessions(t, sessSvc, "userid", "usertoken")
 
+	err := sessSvc.Delete("usertoken")
+	assert.NoError(err)
+
+	_, err = store.Get(sessSvc.ID("usertoken"))
+	assert.Equal(session.ErrNotFound, err)
+
+	members, err := store.Members("user_sessions:userid")
+	assert.NoError(err)
+	assert.Empty(members)
 }
 
-func TestDelete(t *testing.T) {
+func TestUpdate(t *testing.T) {
 	assert := assert.New(t)
-	pool, err := dockertest.NewPool("")
-	if err != nil {
-		t.Fatalf("Could not connect to docker: %s", err)
-	}
 
-	resource, err := pool.Run("redis", "4.0.11", nil)
-	if err != nil {
-		log.Fatalf("Could not start resource: %s", err)
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+
+	user := &chisk.User{
+		DisplayName: "johndoe",
 	}
 
-	port, _ := strconv.Atoi(resource.GetPort("6379/tcp"))
+	err := sessSvc.Update(user)
+	assert.Error(err)
 
-	rclient, err := redis.New("localhost", "", port)
-	if err != nil {
-		t.Fatal(err)
+	user.Token = "usertoken"
+
+	err = sessSvc.Update(user)
+	assert.Equal(session.ErrNotFound, err)
+
+	err = sessSvc.Put(user, "127.0.0.1", "curl/7.54.0")
+	assert.NoError(err)
+
+	user.DisplayName = "janedoe"
+	err = sessSvc.Update(user)
+	assert.NoError(err)
+
+	au, err := sessSvc.Get(context.Background(), "usertoken")
+	assert.NoError(err)
+
+	assert.Equal(&chisk.AuthUser{
+		DisplayName: "janedoe",
+	}, au)
+}
+
+func putSessions(t *testing.T, svc *session.Service, userID string, tokens ...string) {
+	for _, token := range tokens {
+		err := svc.Put(&chisk.User{
+			Base:  chisk.Base{ID: userID},
+			Token: token,
+		}, "127.0.0.1", "curl/7.54.0")
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
+}
 
-	sessSvc := session.New(rclient, 1)
+func sessionIDs(sessions []*session.Session) []string {
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
 
-	err = rclient.Set("usertoken", "value", 1*time.Minute).Err()
+func TestListByUser(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+
+	putSessions(t, sessSvc, "user1", "token1", "token2")
+	putSessions(t, sessSvc, "user2", "token3")
+
+	sessions, err := sessSvc.ListByUser("user1")
 	assert.NoError(err)
+	assert.ElementsMatch([]string{sessSvc.ID("token1"), sessSvc.ID("token2")}, sessionIDs(sessions))
 
-	err = sessSvc.Delete("usertoken")
+	// Expired session is removed from the index
+	assert.NoError(store.Delete(sessSvc.ID("token2")))
+	sessions, err = sessSvc.ListByUser("user1")
 	assert.NoError(err)
+	assert.Equal([]string{sessSvc.ID("token1")}, sessionIDs(sessions))
 
-	err = rclient.Get("usertoken").Err()
-	assert.Error(err)
+	members, err := store.Members("user_sessions:user1")
+	assert.NoError(err)
+	assert.Equal([]string{sessSvc.ID("token1")}, members)
 
-	pool.Purge(resource)
+	assert.NoError(sessSvc.Delete("token1"))
+	sessions, err = sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	assert.Empty(sessions)
 }
 
-func TestUpdate(t *testing.T) {
+func TestRevokeAllForUser(t *testing.T) {
 	assert := assert.New(t)
-	pool, err := dockertest.NewPool("")
-	if err != nil {
-		t.Fatalf("Could not connect to docker: %s", err)
-	}
 
-	resource, err := pool.Run("redis", "4.0.11", nil)
-	if err != nil {
-		log.Fatalf("Could not start resource: %s", err)
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+
+	putSessions(t, sessSvc, "user1", "token1", "token2")
+	putSessions(t, sessSvc, "user2", "token3")
+
+	assert.NoError(sessSvc.RevokeAllForUser("user1"))
+
+	for _, token := range []string{"token1", "token2"} {
+		_, err := sessSvc.Get(context.Background(), token)
+		assert.Equal(session.ErrNotFound, err)
 	}
 
-	port, _ := strconv.Atoi(resource.GetPort("6379/tcp"))
+	_, err := sessSvc.Get(context.Background(), "token3")
+	assert.NoError(err)
+
+	sessions, err := sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	assert.Empty(sessions)
+}
+
+func TestRevokeOthers(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+
+	putSessions(t, sessSvc, "user1", "token1", "token2", "token3")
+
+	assert.NoError(sessSvc.RevokeOthers("user1", "token2"))
+
+	sessions, err := sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	assert.Equal([]string{sessSvc.ID("token2")}, sessionIDs(sessions))
+
+	_, err = sessSvc.Get(context.Background(), "token1")
+	assert.Equal(session.ErrNotFound, err)
+}
+
+func TestTouch(t *testing.T) {
+	assert := assert.New(t)
 
-	rclient, err := redis.New("localhost", "", port)
-	if err != nil {
-		t.Fatal(err)
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+
+	assert.Equal(session.ErrNotFound, sessSvc.Touch(context.Background(), "token1", "127.0.0.1", "curl/7.54.0"))
+
+	putSessions(t, sessSvc, "user1", "token1")
+
+	sessions, err := sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	created := sessions[0]
+
+	// Within touch interval from the same client nothing is written
+	assert.NoError(sessSvc.Touch(context.Background(), "token1", "127.0.0.1", "curl/7.54.0"))
+	sessions, err = sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	assert.Equal(created, sessions[0])
+
+	ua := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_13_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/69.0.3497.100 Safari/537.36"
+	assert.NoError(sessSvc.Touch(context.Background(), "token1", "10.0.0.1", ua))
+	sessions, err = sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	assert.Equal("10.0.0.1", sessions[0].IP)
+	assert.Equal(ua, sessions[0].UserAgent)
+	assert.Equal("Chrome on macOS", sessions[0].Device)
+	assert.Equal(created.CreatedAt, sessions[0].CreatedAt)
+	assert.True(sessions[0].LastSeen.After(created.LastSeen))
+}
+
+func TestGetAndTouch(t *testing.T) {
+	assert := assert.New(t)
+
+	sessSvc := session.New(session.NewMemoryStore(0), opts)
+
+	_, err := sessSvc.GetAndTouch(context.Background(), "token1", "127.0.0.1", "curl/7.54.0")
+	assert.Equal(session.ErrNotFound, err)
+
+	putSessions(t, sessSvc, "user1", "token1")
+
+	u, err := sessSvc.GetAndTouch(context.Background(), "token1", "10.0.0.1", "curl/7.54.0")
+	assert.NoError(err)
+	assert.Equal("user1", u.ID)
+
+	sessions, err := sessSvc.ListByUser("user1")
+	assert.NoError(err)
+	assert.Equal("10.0.0.1", sessions[0].IP, "activity is recorded")
+}
+
+func TestDevice(t *testing.T) {
+	cases := []struct {
+		userAgent string
+		want      string
+	}{
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1",
+			want:      "Safari on iPhone",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36 Edge/18.18362",
+			want:      "Edge on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:63.0) Gecko/20100101 Firefox/63.0",
+			want:      "Firefox on Linux",
+		},
+		{
+			userAgent: "curl/7.54.0",
+			want:      "curl",
+		},
+		{
+			want: "Unknown device",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.want, func(t *testing.T) {
+			sessSvc := session.New(session.NewMemoryStore(0), opts)
+			err := sessSvc.Put(&chisk.User{
+				Base:  chisk.Base{ID: "user1"},
+				Token: "token1",
+			}, "127.0.0.1", tt.userAgent)
+			assert.NoError(t, err)
+
+			sessions, err := sessSvc.ListByUser("user1")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, sessions[0].Device)
+		})
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     session.Options
+		role     chisk.AccessRole
+		touch    bool
+		wantLive bool
+	}{
+		{
+			name:     "Within lifetime",
+			opts:     session.Options{Lifetime: time.Hour},
+			wantLive: true,
+		},
+		{
+			name: "Lifetime exceeded",
+			opts: session.Options{Lifetime: 50 * time.Millisecond, IdleTimeout: time.Hour},
+		},
+		{
+			name: "Idle timeout",
+			opts: session.Options{Lifetime: time.Hour, IdleTimeout: 50 * time.Millisecond},
+		},
+		{
+			name:     "Idle timeout refreshed on activity",
+			opts:     session.Options{Lifetime: time.Hour, IdleTimeout: 50 * time.Millisecond},
+			touch:    true,
+			wantLive: true,
+		},
+		{
+			name:  "Activity does not extend lifetime",
+			opts:  session.Options{Lifetime: 50 * time.Millisecond, IdleTimeout: time.Hour},
+			touch: true,
+		},
+		{
+			name: "Admin idle timeout",
+			opts: session.Options{Lifetime: time.Hour, AdminIdleTimeout: 50 * time.Millisecond},
+			role: chisk.AdminRole,
+		},
+		{
+			name:     "Admin idle timeout does not apply to users",
+			opts:     session.Options{Lifetime: time.Hour, AdminIdleTimeout: 50 * time.Millisecond},
+			role:     chisk.UserRole,
+			wantLive: true,
+		},
 	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			sessSvc := session.New(session.NewMemoryStore(0), tt.opts)
+			err := sessSvc.Put(&chisk.User{
+				Base:  chisk.Base{ID: "user1"},
+				Role:  tt.role,
+				Token: "token1",
+			}, "127.0.0.1", "curl/7.54.0")
+			assert.NoError(t, err)
+
+			time.Sleep(35 * time.Millisecond)
+			if tt.touch {
+				assert.NoError(t, sessSvc.Touch(context.Background(), "token1", "127.0.0.1", "curl/7.54.0"))
+			}
+			time.Sleep(35 * time.Millisecond)
+
+			_, err = sessSvc.Get(context.Background(), "token1")
+			assert.Equal(t, tt.wantLive, err == nil)
+		})
+	}
+}
 
-	sessSvc := session.New(rclient, 1)
+func TestUpdatePreservesExpiration(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, session.Options{Lifetime: time.Hour, IdleTimeout: 50 * time.Millisecond})
 
 	user := &chisk.User{
-		DisplayName: "johndoe",
+		Base:  chisk.Base{ID: "user1"},
+		Token: "token1",
 	}
+	assert.NoError(sessSvc.Put(user, "127.0.0.1", "curl/7.54.0"))
 
-	err = sessSvc.Update(user)
-	assert.Error(err)
+	time.Sleep(35 * time.Millisecond)
+	user.DisplayName = "johndoe"
+	assert.NoError(sessSvc.Update(user))
+	time.Sleep(35 * time.Millisecond)
 
-	user.Token = "usertoken"
+	_, err := sessSvc.Get(context.Background(), "token1")
+	assert.Equal(session.ErrNotFound, err)
+}
 
-	err = sessSvc.Update(user)
-	assert.Error(err)
+type counter map[string]float64
 
-	i := item{
-		User: user.AuthUser(),
-	}
+func (c counter) Add(v float64, labelValues ...string) {
+	c[labelValues[0]] += v
+}
 
-	err = rclient.Set("usertoken", i.encode(), 1*time.Minute).Err()
-	assert.NoError(err)
+func TestEvents(t *testing.T) {
+	assert := assert.New(t)
 
-	err = sessSvc.Update(user)
+	events := counter{}
+	o := opts
+	o.Events = events
+	sessSvc := session.New(session.NewMemoryStore(0), o)
+
+	putSessions(t, sessSvc, "user1", "token1", "token2", "token3", "token4")
+	assert.NoError(sessSvc.Delete("token1"))
+	assert.NoError(sessSvc.RevokeOthers("user1", "token2"))
+	assert.NoError(sessSvc.RevokeAllForUser("user1"))
+
+	assert.Equal(counter{"created": 4, "deleted": 1, "revoked": 3}, events)
+}
+
+func TestIndexExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	o := opts
+	o.Lifetime = 50 * time.Millisecond
+	svc := session.New(store, o)
+
+	assert.NoError(svc.Put(&chisk.User{Base: chisk.Base{ID: "userid"}, Token: "token1"}, "127.0.0.1", ""))
+	members, err := store.Members("user_sessions:userid")
 	assert.NoError(err)
+	assert.Equal([]string{svc.ID("token1")}, members)
 
-	strUser, err := rclient.Get("usertoken").Result()
+	time.Sleep(60 * time.Millisecond)
+	members, err = store.Members("user_sessions:userid")
 	assert.NoError(err)
+	assert.Empty(members, "index expires with the longest possible session")
+}
 
-	item, err := decodeItem(strUser)
+func TestActive(t *testing.T) {
+	assert := assert.New(t)
+
+	store := session.NewMemoryStore(0)
+	sessSvc := session.New(store, opts)
+	putSessions(t, sessSvc, "user1", "token1", "token2")
+	putSessions(t, sessSvc, "user2", "token3")
+	assert.NoError(store.Set("session:expired", []byte("value"), -time.Second))
+	assert.NoError(store.Set("legacy", []byte("value"), time.Minute))
+
+	n, err := sessSvc.Active()
 	assert.NoError(err)
+	assert.Equal(3, n, "expired sessions, legacy sessions and user indexes are not counted")
 
-	assert.Equal(&chisk.AuthUser{
-		DisplayName: "johndoe",
-	}, item.User)
+	_, err = session.New(nopStore{}, opts).Active()
+	assert.Equal(session.ErrCountNotSupported, err)
+}
 
-	pool.Purge(resource)
+// nopStore is a store unable to count its keys
+type nopStore struct {
+	session.Store
 }
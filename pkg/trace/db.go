@@ -0,0 +1,69 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg"
+	"github.com/go-redis/redis"
+
+	"github.com/ribice/chisk/pkg/postgres"
+)
+
+// QueryHook returns go-pg query hook recording queries made within traced requests as client spans,
+// labeled with db name, e.g. primary or replica. Queries get request context through pgsql.Conn.
+func (t *Tracer) QueryHook(name string) func(*pg.QueryProcessedEvent) {
+	return func(ev *pg.QueryProcessedEvent) {
+		db, ok := ev.DB.(interface{ Context() context.Context })
+		if !ok {
+			return
+		}
+		ctx := db.Context()
+
+		query, err := ev.UnformattedQuery()
+		if err != nil {
+			return
+		}
+		op := "QUERY"
+		if f := strings.Fields(query); len(f) > 0 {
+			op = strings.ToUpper(f[0])
+		}
+
+		attrs := map[string]interface{}{
+			"db.system":    "postgresql",
+			"db.name":      name,
+			"db.operation": op,
+			"db.statement": pgsql.Redact(query),
+		}
+		if ev.Result != nil {
+			attrs["db.rows_affected"] = ev.Result.RowsAffected()
+		}
+		t.record(ctx, op, KindClient, ev.StartTime, attrs, ev.Error)
+	}
+}
+
+// InstrumentRedis records commands of c as client spans, if c is bound to a traced request's context
+// with WithContext. It suits session.RedisStore.Instrument.
+func (t *Tracer) InstrumentRedis(c *redis.Client) {
+	ctx := c.Context()
+	if sc := SpanContextFromContext(ctx); !t.recording() || !sc.Valid() || !sc.Sampled {
+		return
+	}
+	c.WrapProcess(func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			spanErr := err
+			if err == redis.Nil {
+				// Missing keys are regular results
+				spanErr = nil
+			}
+			t.record(ctx, strings.ToUpper(cmd.Name()), KindClient, start, map[string]interface{}{
+				"db.system":    "redis",
+				"db.operation": strings.ToUpper(cmd.Name()),
+			}, spanErr)
+			return err
+		}
+	})
+}
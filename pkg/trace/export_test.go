@@ -0,0 +1,159 @@
+package trace_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/trace"
+)
+
+func testSpans() []*trace.Span {
+	parent, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	return []*trace.Span{{
+		Name:       "SELECT",
+		Kind:       trace.KindClient,
+		Context:    trace.SpanContext{TraceID: parent.TraceID, SpanID: trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8}, Sampled: true},
+		Parent:     parent.SpanID,
+		Start:      start,
+		End:        start.Add(1500 * time.Microsecond),
+		Attributes: map[string]interface{}{"db.system": "postgresql", "db.rows_affected": 2},
+		Error:      "canceling statement due to statement timeout",
+	}}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, trace.NewWriterExporter(&buf).Export(context.Background(), testSpans()))
+
+	want := `{"name":"SELECT","kind":"client","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"0102030405060708",` +
+		`"parent_id":"00f067aa0ba902b7","start":"2018-10-01T12:00:00Z","duration_ms":1.5,` +
+		`"attributes":{"db.rows_affected":2,"db.system":"postgresql"},"error":"canceling statement due to statement timeout"}`
+	assert.JSONEq(t, want, buf.String())
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		path, contentType string
+		body              []byte
+		status            = http.StatusOK
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	exp := trace.NewOTLPExporter(srv.URL+"/", "chisk")
+	assert.NoError(t, exp.Export(context.Background(), testSpans()))
+
+	assert.Equal(t, "/v1/traces", path)
+	assert.Equal(t, "application/json", contentType)
+	want := `{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"chisk"}}]},
+		"scopeSpans":[{
+			"scope":{"name":"github.com/ribice/chisk/pkg/trace"},
+			"spans":[{
+				"traceId":"4bf92f3577b34da6a3ce929d0e0e4736",
+				"spanId":"0102030405060708",
+				"parentSpanId":"00f067aa0ba902b7",
+				"name":"SELECT",
+				"kind":3,
+				"startTimeUnixNano":"1538395200000000000",
+				"endTimeUnixNano":"1538395200001500000",
+				"attributes":[
+					{"key":"db.rows_affected","value":{"intValue":"2"}},
+					{"key":"db.system","value":{"stringValue":"postgresql"}}
+				],
+				"status":{"code":2,"message":"canceling statement due to statement timeout"}
+			}]
+		}]
+	}]}`
+	assert.JSONEq(t, want, string(body))
+
+	status = http.StatusBadRequest
+	assert.Error(t, exp.Export(context.Background(), testSpans()))
+}
+
+func TestOTLPExporterRootSpan(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	span := &trace.Span{
+		Name:    "GET /v1/users",
+		Kind:    trace.KindServer,
+		Context: trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}, Sampled: true},
+		Start:   start,
+		End:     start.Add(time.Second),
+		Attributes: map[string]interface{}{
+			"http.status_code": int64(9007199254740993),
+			"http.sampled":     true,
+			"http.ratio":       0.5,
+			"span.kind":        trace.KindServer,
+		},
+	}
+	assert.NoError(t, trace.NewOTLPExporter(srv.URL, "chisk").Export(context.Background(), []*trace.Span{span}))
+
+	// Root spans have no parentSpanId, and integers are strings so that they don't lose precision
+	want := `{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"chisk"}}]},
+		"scopeSpans":[{
+			"scope":{"name":"github.com/ribice/chisk/pkg/trace"},
+			"spans":[{
+				"traceId":"01000000000000000000000000000000",
+				"spanId":"0200000000000000",
+				"name":"GET /v1/users",
+				"kind":2,
+				"startTimeUnixNano":"1538395200000000000",
+				"endTimeUnixNano":"1538395201000000000",
+				"attributes":[
+					{"key":"http.ratio","value":{"doubleValue":0.5}},
+					{"key":"http.sampled","value":{"boolValue":true}},
+					{"key":"http.status_code","value":{"intValue":"9007199254740993"}},
+					{"key":"span.kind","value":{"stringValue":"2"}}
+				],
+				"status":{}
+			}]
+		}]
+	}]}`
+	assert.JSONEq(t, want, string(body))
+}
+
+type logger struct {
+	errs []error
+}
+
+func (l *logger) Log(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
+	l.errs = append(l.errs, err)
+}
+
+type failingExporter struct{}
+
+func (failingExporter) Export(context.Context, []*trace.Span) error {
+	return errors.New("collector unavailable")
+}
+
+func TestExportError(t *testing.T) {
+	log := &logger{}
+	tr := trace.New(failingExporter{}, log, trace.Options{SampleRatio: 1})
+	_, span := tr.Start(context.Background(), "GET", trace.KindServer)
+	span.Finish()
+	tr.Close()
+
+	if assert.Len(t, log.errs, 1) {
+		assert.EqualError(t, log.errs[0], "collector unavailable")
+	}
+}
@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ribice/chisk/pkg/middleware/wrap"
+)
+
+// Middleware traces incoming requests, continuing traces started by clients or upstream services
+// that sent valid traceparent header. Spans are named after request's method and chi route pattern.
+func (t *Tracer) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		parent, _ := ParseTraceparent(r.Header.Get(Header))
+		ctx, span := t.StartRemote(r.Context(), parent, r.Method, KindServer)
+		defer span.Finish()
+
+		rw := wrap.New(w)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("user_agent.original", r.UserAgent())
+		span.SetAttribute("http.response.status_code", rw.Status())
+		if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttribute("http.route", rctx.RoutePattern())
+		}
+		if rw.Status() >= http.StatusInternalServerError {
+			span.SetError(statusError(rw.Status()))
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Transport traces outgoing requests, propagating trace context to called services
+type Transport struct {
+	Tracer *Tracer
+
+	// Base is the underlying transport, http.DefaultTransport if nil
+	Base http.RoundTripper
+}
+
+// RoundTrip executes request in a client span, sending its context in traceparent header
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := t.Tracer.Start(r.Context(), r.Method, KindClient)
+	defer span.Finish()
+	span.SetAttribute("http.request.method", r.Method)
+	span.SetAttribute("server.address", r.URL.Host)
+
+	r = r.Clone(ctx)
+	r.Header.Set(Header, span.Context.Traceparent())
+
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", res.StatusCode)
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetError(statusError(res.StatusCode))
+	}
+	return res, nil
+}
+
+// statusError describes failed HTTP response
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
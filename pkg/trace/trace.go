@@ -0,0 +1,362 @@
+// Package trace records spans of requests, database queries and Redis commands, propagating
+// trace context between services with W3C traceparent header and exporting spans to OpenTelemetry
+// collectors or standard output.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the W3C trace context header
+const Header = "traceparent"
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns hex encoded ID
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span
+type SpanID [8]byte
+
+// String returns hex encoded ID
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span propagated to its children, including remote ones
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Valid reports whether both IDs are set
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats span context as traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses traceparent header value
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	// Version ff is invalid, and version 00 allows no additional fields
+	if parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("invalid traceparent version %q", parts[0])
+	}
+
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid trace ID: %v", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid span ID: %v", err)
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, fmt.Errorf("invalid trace flags: %v", err)
+	}
+	if !sc.Valid() {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// SpanKind describes relationship of the span to its parent and children
+type SpanKind int
+
+// Span kinds, numbered as in OpenTelemetry protocol
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span is a timed operation within a trace
+type Span struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+
+	// Error describes why the operation failed, if it did
+	Error string
+
+	mu     sync.Mutex
+	tracer *Tracer
+	ended  bool
+}
+
+// SetName renames the span, e.g. once request's route is known
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	s.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute sets span attribute. Values should be strings, integers, floats or booleans.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish ends the span, exporting it if it is sampled. Subsequent calls have no effect.
+func (s *Span) Finish() {
+	s.finish(time.Now())
+}
+
+func (s *Span) finish(end time.Time) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = end
+	s.mu.Unlock()
+
+	if s.Context.Sampled && s.tracer != nil && s.tracer.recording() {
+		s.tracer.enqueue(s)
+	}
+}
+
+type ctxKey struct{}
+
+// NewContext returns context carrying span
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// FromContext returns span carried in ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(ctxKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns context of the span carried in ctx, which is invalid if there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := FromContext(ctx); s != nil {
+		return s.Context
+	}
+	return SpanContext{}
+}
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Logger represents logging interface
+type Logger interface {
+	Log(ctx context.Context, source, msg string, err error, params map[string]interface{})
+}
+
+// Options configures tracer
+type Options struct {
+	// ServiceName identifies the service in traces
+	ServiceName string
+
+	// SampleRatio is the share of new traces that are recorded, between 0 and 1.
+	// Traces started by other services are recorded if they were sampled there.
+	SampleRatio float64
+
+	// BatchSize is the maximum number of spans exported at once, defaulting to 512
+	BatchSize int
+
+	// BatchTimeout is how often spans are exported, defaulting to five seconds
+	BatchTimeout time.Duration
+}
+
+// New creates tracer exporting spans through exp in batches.
+// Spans are propagated but not recorded if exp is nil, keeping sampling decisions of remote parents
+// for downstream services.
+func New(exp Exporter, log Logger, o Options) *Tracer {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 512
+	}
+	if o.BatchTimeout <= 0 {
+		o.BatchTimeout = 5 * time.Second
+	}
+	t := &Tracer{exp: exp, log: log, opts: o}
+	if exp != nil {
+		t.queue = make(chan *Span, 4*o.BatchSize)
+		t.done = make(chan struct{})
+		t.stopped = make(chan struct{})
+		go t.run()
+	}
+	return t
+}
+
+// Tracer starts spans and exports the finished ones
+type Tracer struct {
+	exp   Exporter
+	log   Logger
+	opts  Options
+	queue chan *Span
+
+	// done signals run to export queued spans and stop, closing stopped when it does
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Start starts span as a child of the one carried in ctx, or as a new trace root,
+// returning context carrying the new span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	s := t.newSpan(SpanContextFromContext(ctx), name, kind, time.Now())
+	return NewContext(ctx, s), s
+}
+
+// StartRemote starts span as a child of parent received from another service
+func (t *Tracer) StartRemote(ctx context.Context, parent SpanContext, name string, kind SpanKind) (context.Context, *Span) {
+	s := t.newSpan(parent, name, kind, time.Now())
+	return NewContext(ctx, s), s
+}
+
+// record records already finished operation as a child of the span carried in ctx.
+// Operations outside of traces are not recorded, as they would make single span traces.
+func (t *Tracer) record(ctx context.Context, name string, kind SpanKind, start time.Time, attrs map[string]interface{}, err error) {
+	parent := SpanContextFromContext(ctx)
+	if !t.recording() || !parent.Valid() || !parent.Sampled {
+		return
+	}
+	s := t.newSpan(parent, name, kind, start)
+	for k, v := range attrs {
+		s.Attributes[k] = v
+	}
+	s.SetError(err)
+	s.finish(time.Now())
+}
+
+func (t *Tracer) newSpan(parent SpanContext, name string, kind SpanKind, start time.Time) *Span {
+	s := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      start,
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+	if parent.Valid() {
+		s.Context = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+		s.Parent = parent.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+		s.Context.Sampled = t.exp != nil && t.sample(s.Context.TraceID)
+	}
+	rand.Read(s.Context.SpanID[:])
+	return s
+}
+
+// recording reports whether sampled spans are exported
+func (t *Tracer) recording() bool {
+	return t.exp != nil
+}
+
+// sample decides whether to record new trace, consistently for the same trace ID
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.opts.SampleRatio >= 1:
+		return true
+	case t.opts.SampleRatio <= 0:
+		return false
+	}
+	return binary.BigEndian.Uint64(id[8:]) < uint64(t.opts.SampleRatio*math.MaxUint64)
+}
+
+// enqueue queues finished span for export, dropping it if the queue is full or the tracer is closed
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case <-t.done:
+		return
+	default:
+	}
+	select {
+	case t.queue <- s:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(t.opts.BatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.opts.BatchSize)
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.opts.BatchSize {
+				batch = t.export(batch)
+			}
+		case <-ticker.C:
+			batch = t.export(batch)
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// export exports batch, returning it emptied for reuse
+func (t *Tracer) export(batch []*Span) []*Span {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := t.exp.Export(ctx, batch); err != nil && t.log != nil {
+		t.log.Log(ctx, "trace", "Error exporting spans", err, map[string]interface{}{"spans": len(batch)})
+	}
+	return batch[:0]
+}
+
+// Close exports queued spans and stops the tracer
+func (t *Tracer) Close() {
+	if t.done == nil {
+		return
+	}
+	t.once.Do(func() {
+		close(t.done)
+		<-t.stopped
+	})
+}
@@ -0,0 +1,201 @@
+package trace_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/trace"
+)
+
+// exporter records exported spans
+type exporter struct {
+	mu    sync.Mutex
+	spans []*trace.Span
+}
+
+func (e *exporter) Export(_ context.Context, spans []*trace.Span) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		name        string
+		traceparent string
+		wantSampled bool
+		wantErr     bool
+	}{
+		{name: "Sampled", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantSampled: true},
+		{name: "Not sampled", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "Future version with extra fields", traceparent: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantSampled: true},
+		{name: "Empty", wantErr: true},
+		{name: "Invalid version", traceparent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "Extra fields in version 00", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: true},
+		{name: "Zero trace ID", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "Short span ID", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", wantErr: true},
+		{name: "Not hex", traceparent: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", wantErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := trace.ParseTraceparent(tt.traceparent)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			assert.Equal(t, tt.wantSampled, sc.Sampled)
+		})
+	}
+
+	sc, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+}
+
+func TestTracer(t *testing.T) {
+	exp := &exporter{}
+	tr := trace.New(exp, nil, trace.Options{SampleRatio: 1})
+
+	ctx, root := tr.Start(context.Background(), "purge", trace.KindInternal)
+	_, child := tr.Start(ctx, "DELETE", trace.KindClient)
+	child.SetAttribute("db.system", "postgresql")
+	child.SetError(errors.New("deadlock detected"))
+	child.Finish()
+	root.Finish()
+	root.Finish()
+	tr.Close()
+
+	assert.Equal(t, root, trace.FromContext(ctx))
+	assert.True(t, root.Context.Sampled)
+	assert.Equal(t, root.Context.TraceID, child.Context.TraceID)
+	assert.Equal(t, root.Context.SpanID, child.Parent)
+	assert.NotEqual(t, root.Context.SpanID, child.Context.SpanID)
+	assert.Equal(t, []*trace.Span{child, root}, exp.spans, "spans are exported once")
+	assert.Equal(t, "deadlock detected", child.Error)
+	assert.Equal(t, "postgresql", child.Attributes["db.system"])
+}
+
+func TestSampling(t *testing.T) {
+	notSampled, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	sampled, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	cases := []struct {
+		name        string
+		exp         trace.Exporter
+		ratio       float64
+		parent      trace.SpanContext
+		wantSampled bool
+	}{
+		{name: "Ratio one", exp: &exporter{}, ratio: 1, wantSampled: true},
+		{name: "Ratio zero", exp: &exporter{}, ratio: 0},
+		{name: "Sampled remote parent", exp: &exporter{}, parent: sampled, wantSampled: true},
+		{name: "Not sampled remote parent", exp: &exporter{}, ratio: 1, parent: notSampled},
+		{name: "No exporter keeps remote decision", parent: sampled, wantSampled: true},
+		{name: "No exporter", ratio: 1},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := trace.New(tt.exp, nil, trace.Options{SampleRatio: tt.ratio})
+			defer tr.Close()
+			_, span := tr.StartRemote(context.Background(), tt.parent, "GET", trace.KindServer)
+			assert.Equal(t, tt.wantSampled, span.Context.Sampled)
+			assert.True(t, span.Context.Valid())
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := &exporter{}
+	tr := trace.New(exp, nil, trace.Options{SampleRatio: 1})
+
+	var span *trace.Span
+	r := chi.NewRouter()
+	r.Use(tr.Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		span = trace.FromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set(trace.Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	tr.Close()
+
+	if !assert.Len(t, exp.spans, 1) {
+		return
+	}
+	assert.Equal(t, span, exp.spans[0])
+	assert.Equal(t, "GET /users/{id}", span.Name)
+	assert.Equal(t, trace.KindServer, span.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.Context.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.String())
+	assert.Equal(t, "/users/{id}", span.Attributes["http.route"])
+	assert.Equal(t, http.StatusServiceUnavailable, span.Attributes["http.response.status_code"])
+	assert.Equal(t, "Service Unavailable", span.Error)
+}
+
+func TestPropagation(t *testing.T) {
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(trace.Header)
+	}))
+	defer srv.Close()
+
+	tr := trace.New(nil, nil, trace.Options{})
+	client := &http.Client{Transport: &trace.Transport{Tracer: tr}}
+	h := tr.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		res, err := client.Do(req.WithContext(r.Context()))
+		if assert.NoError(t, err) {
+			res.Body.Close()
+		}
+	}))
+
+	for _, flags := range []string{"01", "00"} {
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set(trace.Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-"+flags)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		sc, err := trace.ParseTraceparent(traceparent)
+		assert.NoError(t, err)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+		assert.Equal(t, flags == "01", sc.Sampled, "sampling decision of the parent is propagated without exporter")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(trace.Header)
+	}))
+	defer srv.Close()
+
+	exp := &exporter{}
+	tr := trace.New(exp, nil, trace.Options{SampleRatio: 1, BatchTimeout: time.Hour})
+	ctx, parent := tr.Start(context.Background(), "sync", trace.KindInternal)
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	assert.NoError(t, err)
+	res, err := (&http.Client{Transport: &trace.Transport{Tracer: tr}}).Do(req.WithContext(ctx))
+	assert.NoError(t, err)
+	res.Body.Close()
+	tr.Close()
+
+	if !assert.Len(t, exp.spans, 1) {
+		return
+	}
+	client := exp.spans[0]
+	assert.Equal(t, parent.Context.SpanID, client.Parent)
+	assert.Equal(t, client.Context.Traceparent(), traceparent)
+}
@@ -0,0 +1,103 @@
+package zerolog
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/middleware/wrap"
+	"github.com/ribice/chisk/pkg/requestid"
+	"github.com/ribice/chisk/pkg/trace"
+)
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	entryKey
+)
+
+// entry collects request details known only to inner handlers, such as the authenticated user
+type entry struct {
+	user *chisk.AuthUser
+}
+
+// Middleware logs every request's method, route, status, response size, latency and authenticated user.
+// Requests get a child logger, stored in context and used by Log, so that all their logs share request fields.
+// It has to run after requestid and trace middleware for logs to include request and trace IDs.
+func (z *ZLog) Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		lc := z.logger.With()
+		if id := requestid.FromContext(r.Context()); id != "" {
+			lc = lc.Str("request_id", id)
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.Valid() {
+			lc = lc.Str("trace_id", sc.TraceID.String()).Str("span_id", sc.SpanID.String())
+		}
+		logger := lc.Logger()
+
+		e := &entry{}
+		ctx := context.WithValue(r.Context(), loggerKey, &logger)
+		ctx = context.WithValue(ctx, entryKey, e)
+
+		rw := wrap.New(w)
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		fields := map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rw.Status(),
+			"bytes":       rw.Bytes(),
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"user_agent":  r.UserAgent(),
+		}
+		if rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context); ok {
+			fields["route"] = rctx.RoutePattern()
+		}
+		if e.user != nil {
+			fields["user_id"] = e.user.ID
+		}
+
+		z.redact.params(fields)
+
+		ev := logger.Info()
+		if rw.Status() >= http.StatusInternalServerError {
+			ev = logger.Error()
+		}
+		ev.Fields(fields).Msg("Request processed")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// RecordUser adds the authenticated user, stored in context by authentication middleware, to request logs.
+// It has to run after authentication middleware.
+func RecordUser(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if user, ok := ctx.Value(chisk.KeyString("_authuser")).(*chisk.AuthUser); ok {
+			if e, ok := ctx.Value(entryKey).(*entry); ok {
+				e.user = user
+			}
+			if l, ok := ctx.Value(loggerKey).(*zerolog.Logger); ok {
+				child := l.With().Str("user_id", user.ID).Logger()
+				ctx = context.WithValue(ctx, loggerKey, &child)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// FromContext returns request scoped logger created by Middleware, or the base logger outside of requests
+func (z *ZLog) FromContext(ctx context.Context) *zerolog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*zerolog.Logger); ok {
+		return l
+	}
+	return z.logger
+}
@@ -0,0 +1,129 @@
+package zerolog_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/requestid"
+	"github.com/ribice/chisk/pkg/trace"
+	"github.com/ribice/chisk/pkg/zerolog"
+)
+
+// captureLogs returns logger writing to a pipe, along with a function returning logged lines
+func captureLogs(t *testing.T) (*zerolog.ZLog, func() []map[string]interface{}) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	log, err := zerolog.New(zerolog.Options{})
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return log, func() []map[string]interface{} {
+		w.Close()
+		var lines []map[string]interface{}
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			var l map[string]interface{}
+			assert.NoError(t, json.Unmarshal(sc.Bytes(), &l))
+			lines = append(lines, l)
+		}
+		return lines
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	log, lines := captureLogs(t)
+
+	authenticate := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), chisk.KeyString("_authuser"), &chisk.AuthUser{ID: "uid"})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(requestid.Middleware, log.Middleware)
+	r.With(authenticate, zerolog.RecordUser).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		log.Log(r.Context(), "test", "Handling request", nil, nil)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	})
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("X-Request-ID", "reqid")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	logs := lines()
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+
+	assert.Equal(t, "Handling request", logs[0]["message"])
+	assert.Equal(t, "reqid", logs[0]["request_id"])
+	assert.Equal(t, "uid", logs[0]["user_id"])
+
+	access := logs[1]
+	assert.Equal(t, "Request processed", access["message"])
+	assert.Equal(t, "reqid", access["request_id"])
+	assert.Equal(t, "uid", access["user_id"])
+	assert.Equal(t, "GET", access["method"])
+	assert.Equal(t, "/users/{id}", access["route"])
+	assert.Equal(t, "/users/42", access["path"])
+	assert.Equal(t, float64(http.StatusTeapot), access["status"])
+	assert.Equal(t, float64(len("short and stout")), access["bytes"])
+	assert.Contains(t, access, "duration_ms")
+}
+
+func TestRequestIDOutsideRequests(t *testing.T) {
+	log, lines := captureLogs(t)
+	log.Log(requestid.NewContext(context.Background(), "reqid"), "job", "Processing", nil, nil)
+
+	logs := lines()
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "reqid", logs[0]["request_id"])
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	log, err := zerolog.New(zerolog.Options{})
+	assert.NoError(t, err)
+	assert.NotNil(t, log.FromContext(context.Background()))
+}
+
+func TestTraceIDs(t *testing.T) {
+	log, lines := captureLogs(t)
+
+	r := chi.NewRouter()
+	r.Use(trace.New(nil, nil, trace.Options{}).Middleware, log.Middleware)
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+		log.Log(r.Context(), "test", "Handling request", nil, nil)
+	})
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set(trace.Header, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	logs := lines()
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+	for _, l := range logs {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", l["trace_id"])
+		assert.Len(t, l["span_id"], 16)
+		assert.NotEqual(t, "00f067aa0ba902b7", l["span_id"], "logs carry the server span, not the remote parent")
+	}
+}
@@ -0,0 +1,149 @@
+package zerolog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Redaction defaults, used when options leave them empty
+var (
+	DefaultRedactFields   = []string{"email", "password", "token", "authorization", "cookie", "username", "phone_number"}
+	DefaultRedactPatterns = []string{`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`}
+)
+
+const redacted = "[REDACTED]"
+
+// RedactOptions configures redaction of personal data from logs
+type RedactOptions struct {
+	// Fields are case insensitive names of fields and headers whose values are redacted.
+	// Structs, slices and maps are matched by their JSON field names and keys.
+	Fields []string
+
+	// Patterns are regular expressions matching personal data within other string values
+	Patterns []string
+
+	// HashKey, when set, replaces redacted values with their keyed hash instead of a mask,
+	// so that entries of the same user can still be correlated
+	HashKey string
+}
+
+// newRedactor compiles redaction options, falling back to defaults
+func newRedactor(o RedactOptions) (*redactor, error) {
+	fields, patterns := o.Fields, o.Patterns
+	if len(fields) == 0 {
+		fields = DefaultRedactFields
+	}
+	if len(patterns) == 0 {
+		patterns = DefaultRedactPatterns
+	}
+
+	r := &redactor{fields: make(map[string]bool, len(fields))}
+	for _, f := range fields {
+		r.fields[strings.ToLower(f)] = true
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if o.HashKey != "" {
+		r.hashKey = []byte(o.HashKey)
+	}
+	return r, nil
+}
+
+// redactor masks or hashes personal data in log fields
+type redactor struct {
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+	hashKey  []byte
+}
+
+// params redacts params in place
+func (r *redactor) params(params map[string]interface{}) {
+	for k, v := range params {
+		params[k] = r.field(k, v)
+	}
+}
+
+func (r *redactor) field(key string, v interface{}) interface{} {
+	if r.fields[strings.ToLower(key)] {
+		return r.value(fmt.Sprint(v))
+	}
+
+	switch v := v.(type) {
+	case string:
+		return r.string(v)
+	case error:
+		return r.string(v.Error())
+	case http.Header:
+		h := make(http.Header, len(v))
+		for name, values := range v {
+			for _, hv := range values {
+				h.Add(name, r.field(name, hv).(string))
+			}
+		}
+		return h
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, mv := range v {
+			m[k] = r.field(k, mv)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, sv := range v {
+			s[i] = r.field(key, sv)
+		}
+		return s
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64,
+		json.Number, time.Duration, time.Time:
+		return v
+	default:
+		return r.field(key, r.generic(v))
+	}
+}
+
+// generic converts v to its JSON representation, so that structs, slices and maps can be walked
+// by their JSON field names. Values that can't be encoded are converted to strings.
+func (r *redactor) generic(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var g interface{}
+	if err := d.Decode(&g); err != nil {
+		return fmt.Sprint(v)
+	}
+	return g
+}
+
+// string redacts pattern matches within s
+func (r *redactor) string(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, r.value)
+	}
+	return s
+}
+
+// value masks or hashes v
+func (r *redactor) value(v string) string {
+	if r.hashKey == nil || v == "" {
+		return redacted
+	}
+	h := hmac.New(sha256.New, r.hashKey)
+	h.Write([]byte(v))
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
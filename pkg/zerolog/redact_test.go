@@ -0,0 +1,114 @@
+package zerolog_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/zerolog"
+)
+
+// credentials is a struct logged as is, redacted by its JSON field names
+type credentials struct {
+	Login    string `json:"login"`
+	Password string
+	Note     string
+}
+
+func TestRedaction(t *testing.T) {
+	cases := []struct {
+		name        string
+		opts        zerolog.RedactOptions
+		wantErr     bool
+		wantContain []string
+		wantMissing []string
+	}{
+		{
+			name:    "Invalid pattern",
+			opts:    zerolog.RedactOptions{Patterns: []string{"("}},
+			wantErr: true,
+		},
+		{
+			name: "Defaults mask values",
+			wantContain: []string{
+				`"message":"Signed up [REDACTED]"`,
+				`"email":"[REDACTED]"`,
+				`"Password":"[REDACTED]"`,
+				`"username":"[REDACTED]"`,
+				`"Authorization":["[REDACTED]"]`,
+				`"Accept":["application/json"]`,
+				`"error":"sending mail to [REDACTED] failed"`,
+				`"note":"ssn 123-45-6789"`,
+				`"id":"uid"`,
+				`"credentials":{"Note":"ssn 987-65-4321","Password":"[REDACTED]","login":"jane"}`,
+				`"labels":{"contact":"[REDACTED]","phone_number":"[REDACTED]"}`,
+				`"recipients":["[REDACTED]"]`,
+				`"attempts":3`,
+			},
+			wantMissing: []string{"john@example.org", "hunter2", "John Doe", "Bearer", "s3cr3t", "jane@example.org", "111 2222"},
+		},
+		{
+			name: "Custom fields and patterns hash values",
+			opts: zerolog.RedactOptions{
+				Fields:   []string{"password"},
+				Patterns: []string{`\d{3}-\d{2}-\d{4}`},
+				HashKey:  "secret",
+			},
+			wantContain: []string{
+				`"Password":"sha256:`,
+				`"note":"ssn sha256:`,
+				`"email":"john@example.org"`,
+				`"Note":"ssn sha256:`,
+				`"phone_number":"+385 91 111 2222"`,
+			},
+			wantMissing: []string{"hunter2", "123-45-6789", "s3cr3t", "987-65-4321"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "logs")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "api.log")
+			log, err := zerolog.New(zerolog.Options{File: path, Redact: tt.opts})
+			assert.Equal(t, tt.wantErr, err != nil)
+			if tt.wantErr {
+				return
+			}
+
+			ctx := context.WithValue(context.Background(), chisk.KeyString("_authuser"), &chisk.AuthUser{ID: "uid", DisplayName: "John Doe"})
+			log.Log(ctx, "test", "Signed up john@example.org", errors.New("sending mail to john@example.org failed"), map[string]interface{}{
+				"email":    "john@example.org",
+				"Password": "hunter2",
+				"note":     "ssn 123-45-6789",
+				"headers": http.Header{
+					"Authorization": {"Bearer token"},
+					"Accept":        {"application/json"},
+				},
+				"credentials": credentials{Login: "jane", Password: "s3cr3t", Note: "ssn 987-65-4321"},
+				"labels":      map[string]string{"phone_number": "+385 91 111 2222", "contact": "jane@example.org"},
+				"recipients":  []string{"jane@example.org"},
+				"attempts":    3,
+			})
+			assert.NoError(t, log.Close())
+
+			b, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			out := string(b)
+			for _, s := range tt.wantContain {
+				assert.Contains(t, out, s)
+			}
+			for _, s := range tt.wantMissing {
+				assert.False(t, strings.Contains(out, s), "log contains %q", s)
+			}
+		})
+	}
+}
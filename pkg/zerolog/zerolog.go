@@ -2,45 +2,155 @@ package zerolog
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/ribice/chisk/model"
+	"github.com/ribice/chisk/pkg/requestid"
+	"github.com/ribice/chisk/pkg/trace"
 
 	"github.com/rs/zerolog"
 )
 
+// Options configures logger. Zero value logs JSON to standard output at info level.
+type Options struct {
+	// Level is the minimum logged level, one of debug, info, warn and error
+	Level string
+
+	// Format is either json or console, a human-readable format for development
+	Format string
+
+	// SampleInfo logs only every n-th info level entry when greater than 1
+	SampleInfo uint32
+
+	// File is the path of log file written instead of standard output
+	File string
+
+	// MaxSizeMB is the size log file is rotated at, zero disabling rotation
+	MaxSizeMB int
+
+	// MaxBackups is the number of rotated log files kept
+	MaxBackups int
+
+	// Redact configures masking of personal data, which is always on
+	Redact RedactOptions
+}
+
 // ZLog represents zerolog logger
 type ZLog struct {
 	logger *zerolog.Logger
+	closer io.Closer
+	redact *redactor
 }
 
 // New instantiates new zero logger
-func New() *ZLog {
-	z := zerolog.New(os.Stdout)
+func New(o Options) (*ZLog, error) {
+	level := zerolog.InfoLevel
+	if o.Level != "" {
+		var err error
+		if level, err = zerolog.ParseLevel(o.Level); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", o.Level)
+		}
+	}
+
+	redact, err := newRedactor(o.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		w      io.Writer = os.Stdout
+		closer io.Closer
+	)
+	if o.File != "" {
+		f, err := newRotatingFile(o.File, int64(o.MaxSizeMB)<<20, o.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	}
+
+	switch o.Format {
+	case "", "json":
+	case "console":
+		w = zerolog.ConsoleWriter{Out: w, NoColor: o.File != ""}
+	default:
+		return nil, fmt.Errorf("unknown log format %q", o.Format)
+	}
+
+	z := zerolog.New(w).Level(level).With().Timestamp().Logger()
+	if o.SampleInfo > 1 {
+		z = z.Sample(zerolog.LevelSampler{InfoSampler: &zerolog.BasicSampler{N: o.SampleInfo}})
+	}
+
 	return &ZLog{
 		logger: &z,
+		closer: closer,
+		redact: redact,
+	}, nil
+}
+
+// Close closes log file, if any
+func (z *ZLog) Close() error {
+	if z.closer == nil {
+		return nil
 	}
+	return z.closer.Close()
 }
 
-// Log logs using zerolog
+// Log logs using zerolog, through request scoped logger if ctx carries one
 func (z *ZLog) Log(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
+	params = z.fields(ctx, source, err, params)
 
-	if params == nil {
-		params = make(map[string]interface{})
+	logger := z.FromContext(ctx)
+	if err != nil {
+		logger.Error().Fields(params).Msg(z.redact.string(msg))
+		return
 	}
 
-	params["source"] = source
+	logger.Info().Fields(params).Msg(z.redact.string(msg))
+}
+
+// Debug logs at debug level, which is disabled unless configured
+func (z *ZLog) Debug(ctx context.Context, source, msg string, params map[string]interface{}) {
+	z.FromContext(ctx).Debug().Fields(z.fields(ctx, source, nil, params)).Msg(z.redact.string(msg))
+}
+
+// Warn logs at warn level
+func (z *ZLog) Warn(ctx context.Context, source, msg string, err error, params map[string]interface{}) {
+	z.FromContext(ctx).Warn().Fields(z.fields(ctx, source, err, params)).Msg(z.redact.string(msg))
+}
+
+// fields adds source, error and authenticated user to a copy of params, redacting personal data
+func (z *ZLog) fields(ctx context.Context, source string, err error, params map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(params)+4)
+	for k, v := range params {
+		fields[k] = v
+	}
+
+	fields["source"] = source
+
+	// Request scoped loggers already include request and trace IDs
+	if _, ok := ctx.Value(loggerKey).(*zerolog.Logger); !ok {
+		if id := requestid.FromContext(ctx); id != "" {
+			fields["request_id"] = id
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.Valid() {
+			fields["trace_id"] = sc.TraceID.String()
+			fields["span_id"] = sc.SpanID.String()
+		}
+	}
 
 	if user, ok := ctx.Value(chisk.KeyString("_authuser")).(*chisk.AuthUser); ok {
-		params["id"] = user.ID
-		params["username"] = user.DisplayName
+		fields["id"] = user.ID
+		fields["username"] = user.DisplayName
 	}
 
 	if err != nil {
-		params["error"] = err
-		z.logger.Error().Fields(params).Msg(msg)
-		return
+		fields["error"] = err
 	}
 
-	z.logger.Info().Fields(params).Msg(msg)
+	z.redact.params(fields)
+	return fields
 }
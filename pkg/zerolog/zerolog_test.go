@@ -0,0 +1,132 @@
+package zerolog_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ribice/chisk/pkg/zerolog"
+)
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		name    string
+		opts    zerolog.Options
+		wantErr bool
+	}{
+		{name: "Defaults"},
+		{name: "Unknown level", opts: zerolog.Options{Level: "verbose"}, wantErr: true},
+		{name: "Unknown format", opts: zerolog.Options{Format: "xml"}, wantErr: true},
+		{name: "Console", opts: zerolog.Options{Level: "debug", Format: "console"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := zerolog.New(tt.opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestLevels(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := os.MkdirTemp("", "logs")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.log")
+	log, err := zerolog.New(zerolog.Options{Level: "warn", File: path})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	log.Debug(ctx, "test", "debug", nil)
+	log.Log(ctx, "test", "info", nil, nil)
+	log.Warn(ctx, "test", "warn", nil, nil)
+	log.Log(ctx, "test", "error", os.ErrNotExist, nil)
+	assert.NoError(log.Close())
+
+	b, err := os.ReadFile(path)
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if assert.Len(lines, 2) {
+		assert.Contains(lines[0], `"level":"warn"`)
+		assert.Contains(lines[1], `"level":"error"`)
+		assert.Contains(lines[1], `"error":"file does not exist"`)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := os.MkdirTemp("", "logs")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.log")
+	log, err := zerolog.New(zerolog.Options{SampleInfo: 5, File: path})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		log.Log(ctx, "test", "info", nil, nil)
+		log.Warn(ctx, "test", "warn", nil, nil)
+	}
+	assert.NoError(log.Close())
+
+	b, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(2, strings.Count(string(b), `"level":"info"`))
+	assert.Equal(10, strings.Count(string(b), `"level":"warn"`))
+}
+
+func TestRotation(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := os.MkdirTemp("", "logs")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.log")
+	log, err := zerolog.New(zerolog.Options{File: path, MaxSizeMB: 1, MaxBackups: 2})
+	assert.NoError(err)
+
+	params := map[string]interface{}{"padding": strings.Repeat("x", 100<<10)}
+	for i := 0; i < 40; i++ {
+		log.Log(context.Background(), "test", "info", nil, params)
+	}
+	assert.NoError(log.Close())
+
+	for _, name := range []string{"api.log", "api.log.1", "api.log.2"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if assert.NoError(err) {
+			assert.True(info.Size() <= 1<<20)
+		}
+	}
+	_, err = os.Stat(filepath.Join(dir, "api.log.3"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestRotationFailure(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := os.MkdirTemp("", "logs")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Backup path taken by a non-empty directory makes renaming the log file fail
+	path := filepath.Join(dir, "api.log")
+	assert.NoError(os.MkdirAll(filepath.Join(path+".1", "taken"), 0755))
+
+	log, err := zerolog.New(zerolog.Options{File: path, MaxSizeMB: 1, MaxBackups: 1})
+	assert.NoError(err)
+
+	params := map[string]interface{}{"padding": strings.Repeat("x", 100<<10)}
+	for i := 0; i < 15; i++ {
+		log.Log(context.Background(), "test", "info", nil, params)
+	}
+	assert.NoError(log.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(15, strings.Count(string(data), "\n"), "logs are kept in the current file")
+}